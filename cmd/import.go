@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	v1 "poc-cloud-service/gen/api/v1"
+)
+
+var (
+	importServer    string
+	importClusterID string
+	importPlanID    string
+	importDryRun    bool
+)
+
+// importCmd adopts an existing tenant namespace and application through the API
+var importCmd = &cobra.Command{
+	Use:   "import <tenant-id>",
+	Short: "Create a tenant from its existing namespace and Argo CD application",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conn, err := grpc.NewClient(importServer, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		resp, err := v1.NewTenantServiceClient(conn).ImportTenant(cmd.Context(), &v1.ImportTenantRequest{
+			Id:           args[0],
+			ClusterId:    importClusterID,
+			PlanId:       importPlanID,
+			ValidateOnly: importDryRun,
+		})
+		if err != nil {
+			return err
+		}
+		out, err := protojson.MarshalOptions{Multiline: true}.Marshal(resp.GetTenant())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(out))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&importServer, "server", "localhost:8080", "gRPC address of the service")
+	importCmd.Flags().StringVar(&importClusterID, "cluster-id", "", "Cluster holding the tenant namespace, the local cluster when unset")
+	importCmd.Flags().StringVar(&importPlanID, "plan-id", "", "Plan of the tenant")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Print the tenant without creating it")
+}
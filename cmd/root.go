@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"poc-cloud-service/log"
+	"strings"
 )
 
 var cfgFile string
@@ -18,15 +21,46 @@ var rootCmd = &cobra.Command{
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	err := rootCmd.Execute()
+	var exitErr exitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
 }
 
+// Exit codes of the commands
+const (
+	exitFailure = 1
+	// exitShutdownTimeout is returned when serve stopped before its requests and reconciliation were done
+	exitShutdownTimeout = 2
+	// exitInterrupted is returned when a second signal cut the shutdown short
+	exitInterrupted = 130
+)
+
+// exitError is an error that exits with a specific code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.poc-cloud-service.yaml)")
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().String("log-level", "info", "Log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().String("log-format", log.FormatJSON, "Log format (json, console)")
+	cobra.CheckErr(viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level")))
+	cobra.CheckErr(viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format")))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -45,10 +79,14 @@ func initConfig() {
 		viper.SetConfigName(".poc-cloud-service")
 	}
 
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+
+	// Flags take precedence over LOG_LEVEL and LOG_FORMAT, then over the config file
+	cobra.CheckErr(log.Configure(viper.GetString("log-level"), viper.GetString("log-format")))
 }
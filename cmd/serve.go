@@ -2,13 +2,18 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/cors"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -16,19 +21,51 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/charts"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/deploy"
+	"poc-cloud-service/internal/health"
+	"poc-cloud-service/internal/metrics"
 	"poc-cloud-service/internal/reconciler"
+	"poc-cloud-service/internal/secrets"
 	"poc-cloud-service/internal/server"
 	"poc-cloud-service/internal/store"
+	"poc-cloud-service/internal/tracing"
 	"poc-cloud-service/log"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var (
-	grpcAddr string
-	httpAddr string
-	dsn      string
+	grpcAddr      string
+	httpAddr      string
+	dsn           string
+	gitopsBackend string
+	chartCacheDir string
+	secretKeyFile string
+	driftMode     string
+	metricsAddr   string
+	// shutdownTimeout bounds the graceful shutdown
+	shutdownTimeout time.Duration
+	// reconcilerHeartbeatTimeout is how long the reconciler may go without starting or ending a pass before liveness fails
+	reconcilerHeartbeatTimeout time.Duration
+	// export of traces
+	traceOptions tracing.Options
+	// orphan deletion safeguards of the reconciler
+	orphanPolicy             string
+	orphanGracePeriod        time.Duration
+	maxOrphanDeletions       int
+	maxOrphanDeletionPercent int
+	// retention of tenant events
+	eventRetention  time.Duration
+	maxTenantEvents int
+	// trustedProxies may tell who makes a request with the forwarded user headers
+	trustedProxies []string
 )
 
 const (
@@ -37,17 +74,32 @@ const (
 
 // serveCmd represents the serve command
 var serveCmd = &cobra.Command{
-	Use: "serve",
+	Use:          "serve",
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx, cancel := context.WithCancel(cmd.Context())
 		defer cancel()
+		startTime := time.Now()
 
 		logger := log.FromContext(ctx)
 
-		signalChan := make(chan os.Signal, 1)
+		// The first signal starts the graceful shutdown once serving, a second one exits right away.
+		// Before serving, the first one cancels ctx to abort the startup, such as the informer cache sync.
+		signalChan := make(chan os.Signal, 2)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signalChan)
+		stopping := make(chan os.Signal, 1)
+		serving := make(chan struct{})
 		go func() {
-			<-signalChan
-			cancel()
+			stopping <- <-signalChan
+			select {
+			case <-serving:
+			default:
+				cancel()
+			}
+			sig := <-signalChan
+			logger.Error("forced shutdown", zap.String("signal", sig.String()))
+			os.Exit(exitInterrupted)
 		}()
 
 		config, err := rest.InClusterConfig()
@@ -63,6 +115,17 @@ var serveCmd = &cobra.Command{
 			}
 		}
 
+		shutdownTracing, err := tracing.Setup(ctx, traceOptions)
+		if err != nil {
+			logger.Fatal("failed to set up tracing", zap.Error(err))
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				logger.Error("failed to flush traces", zap.Error(err))
+			}
+		}()
+		tracing.WrapConfig(config)
+
 		client, err := kubernetes.NewForConfig(config)
 		if err != nil {
 			logger.Fatal("failed to create kubernetes client", zap.Error(err))
@@ -76,6 +139,10 @@ var serveCmd = &cobra.Command{
 		}
 
 		if err := store.Migrate(ctx, dsn); err != nil {
+			if ctx.Err() != nil {
+				logger.Info("shutting down before serving")
+				return nil
+			}
 			logger.Fatal("failed to migrate database", zap.Error(err))
 		}
 
@@ -84,19 +151,102 @@ var serveCmd = &cobra.Command{
 			logger.Fatal("failed to create pgx pool", zap.Error(err))
 		}
 
-		storeObj := store.New(pool)
+		instrumentDB := func(db store.DBTX) store.DBTX {
+			return tracing.InstrumentDB(metrics.InstrumentDB(db))
+		}
+		storeObj := store.New(instrumentDB(pool))
+		transactor := store.NewTransactor(pool, instrumentDB)
+		if err := metrics.RegisterPool(pool); err != nil {
+			logger.Fatal("failed to register pool metrics", zap.Error(err))
+		}
 
 		dynamicClient, err := dynamic.NewForConfig(config)
 		if err != nil {
 			logger.Fatal("failed to create dynamic client", zap.Error(err))
 		}
 
-		r := reconciler.NewReconciler(client, dynamicClient, storeObj)
+		fetcher := charts.NewFetcher(chartCacheDir)
+		clusters := cluster.NewRegistry(client, config, storeObj)
+		deployer, err := deploy.New(ctx, gitopsBackend, client, dynamicClient, fetcher, clusters)
+		if ctx.Err() != nil {
+			// The cache sync was aborted by a signal
+			logger.Info("shutting down before serving")
+			pool.Close()
+			return nil
+		}
+		if err != nil {
+			logger.Fatal("failed to create deployer", zap.Error(err))
+		}
+
+		var envelope *secrets.Envelope
+		if len(secretKeyFile) > 0 {
+			kms, err := secrets.LoadLocalKMS(secretKeyFile)
+			if err != nil {
+				logger.Fatal("failed to load secret values keys", zap.Error(err))
+			}
+			envelope = secrets.NewEnvelope(kms)
+		}
+
+		proxies, err := log.ParseTrustedProxies(trustedProxies)
+		if err != nil {
+			logger.Fatal("failed to parse trusted proxies", zap.Error(err))
+		}
+
+		if driftMode != reconciler.DriftModeCorrect && driftMode != reconciler.DriftModeReport {
+			logger.Fatal("unknown drift mode", zap.String("drift-mode", driftMode))
+		}
+		switch orphanPolicy {
+		case reconciler.OrphanPolicyDelete, reconciler.OrphanPolicyRetain, reconciler.OrphanPolicyReport:
+		default:
+			logger.Fatal("unknown orphan policy", zap.String("orphan-policy", orphanPolicy))
+		}
+
+		r := reconciler.NewReconciler(client, deployer, storeObj, clusters, envelope, reconciler.Options{
+			DriftMode:                driftMode,
+			OrphanPolicy:             orphanPolicy,
+			OrphanGracePeriod:        orphanGracePeriod,
+			MaxOrphanDeletions:       maxOrphanDeletions,
+			MaxOrphanDeletionPercent: maxOrphanDeletionPercent,
+			EventRetention:           eventRetention,
+			MaxTenantEvents:          maxTenantEvents,
+		})
+		// The reconciler is stopped on its own context, to let it finish the current tenant while the servers drain
+		reconcilerCtx, stopReconciler := context.WithCancel(ctx)
+		defer stopReconciler()
+		reconcilerDone := make(chan struct{})
 		go func() {
-			r.Start(ctx)
+			r.Start(reconcilerCtx)
+			close(reconcilerDone)
 		}()
 
-		srv, err := server.NewServer(ctx, client, dynamicClient, storeObj)
+		latestMigration, err := store.LatestMigration()
+		if err != nil {
+			logger.Fatal("failed to read migrations", zap.Error(err))
+		}
+		checker := health.NewChecker()
+		checker.AddLiveness("reconciler", health.Heartbeat(r.LastProgress, startTime, reconcilerHeartbeatTimeout))
+		checker.AddReadiness("database", pool.Ping)
+		checker.AddReadiness("migrations", func(ctx context.Context) error {
+			version, dirty, err := store.MigrationVersion(ctx, pool)
+			if err != nil {
+				return err
+			}
+			if dirty {
+				return fmt.Errorf("migration %d failed", version)
+			}
+			if version < latestMigration {
+				return fmt.Errorf("database is at migration %d, expected %d", version, latestMigration)
+			}
+			return nil
+		})
+		checker.AddReadiness("informers", func(ctx context.Context) error {
+			if !deploy.HasSynced(deployer) {
+				return fmt.Errorf("informer caches are not synced")
+			}
+			return nil
+		})
+
+		srv, err := server.NewServer(ctx, client, deployer, storeObj, transactor, envelope, fetcher, clusters)
 		if err != nil {
 			logger.Fatal("failed to create server", zap.Error(err))
 		}
@@ -106,18 +256,22 @@ var serveCmd = &cobra.Command{
 			logger.Fatal("failed to create listener", zap.Error(err))
 		}
 
-		defer func() {
-			if err := listener.Close(); err != nil {
-				logger.Error("failed to close listener", zap.Error(err))
-			}
-		}()
-
-		grpcServer := grpc.NewServer(grpc.Creds(insecure.NewCredentials()))
+		grpcServer := grpc.NewServer(
+			grpc.Creds(insecure.NewCredentials()),
+			grpc.StatsHandler(otelgrpc.NewServerHandler()),
+			grpc.ChainUnaryInterceptor(log.UnaryServerInterceptor(proxies), metrics.UnaryServerInterceptor),
+		)
 		v1.RegisterTenantServiceServer(grpcServer, srv)
+		healthServer := grpchealth.NewServer()
+		healthpb.RegisterHealthServer(grpcServer, healthServer)
+		go checker.Watch(ctx, healthServer, 10*time.Second, v1.TenantService_ServiceDesc.ServiceName)
 
+		// Servers report why they stopped serving, which stops the command
+		serveErrs := make(chan error, 3)
 		go func() {
+			logger.Info("starting gRPC server", zap.String("address", grpcAddr))
 			if err := grpcServer.Serve(listener); err != nil {
-				logger.Fatal("failed to serve", zap.Error(err))
+				serveErrs <- fmt.Errorf("failed to serve gRPC: %w", err)
 			}
 		}()
 
@@ -126,7 +280,10 @@ var serveCmd = &cobra.Command{
 			logger.Fatal("failed to split host and port", zap.Error(err))
 		}
 
-		grpcClient, err := grpc.NewClient("localhost:"+grpcPort, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		grpcClient, err := grpc.NewClient("localhost:"+grpcPort,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		)
 		if err != nil {
 			return err
 		}
@@ -136,7 +293,14 @@ var serveCmd = &cobra.Command{
 			}
 		}()
 
-		mux := runtime.NewServeMux()
+		// The headers identifying requests reach the gRPC server, to be logged with them
+		mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			switch http.CanonicalHeaderKey(key) {
+			case log.RequestIDHeader, log.UserHeader, log.EmailHeader:
+				return strings.ToLower(key), true
+			}
+			return runtime.DefaultHeaderMatcher(key)
+		}))
 		if err = v1.RegisterTenantServiceHandler(ctx, mux, grpcClient); err != nil {
 			logger.Fatal("failed to register gateway TenantServiceHandler", zap.Error(err))
 		}
@@ -144,30 +308,136 @@ var serveCmd = &cobra.Command{
 		spa := spaHandler{staticPath: "ui/dist", indexPath: "index.html"}
 
 		httpMux := http.NewServeMux()
-		httpMux.Handle("/v1/", mux)
-		httpMux.Handle("/", spa)
+		httpMux.Handle("/v1/", metrics.InstrumentHandler("api", tracing.Handler("gateway", mux)))
+		httpMux.Handle("/", metrics.InstrumentHandler("ui", spa))
+		checker.Register(httpMux)
 
-		handler := cors.AllowAll().Handler(httpMux)
+		handler := log.HTTPHandler(cors.AllowAll().Handler(httpMux), proxies, "/livez", "/readyz", "/healthz")
 
 		gwServer := &http.Server{
 			Addr:    httpAddr,
 			Handler: handler,
 		}
 
-		logger.Info("starting server", zap.String("address", httpAddr))
-		if err := gwServer.ListenAndServe(); err != nil {
-			logger.Fatal("failed to serve", zap.Error(err))
+		httpServers := []*http.Server{gwServer}
+		go func() {
+			logger.Info("starting server", zap.String("address", httpAddr))
+			if err := gwServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serveErrs <- fmt.Errorf("failed to serve HTTP: %w", err)
+			}
+		}()
+
+		// Metrics and the log level are served on their own listener, to keep them off the public address
+		if len(metricsAddr) > 0 {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("/metrics", metrics.Handler())
+			metricsMux.Handle("/log/level", log.Level())
+			metricsServer := &http.Server{
+				Addr:    metricsAddr,
+				Handler: metricsMux,
+			}
+			httpServers = append(httpServers, metricsServer)
+			go func() {
+				logger.Info("starting metrics server", zap.String("address", metricsAddr))
+				if err := metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+					serveErrs <- fmt.Errorf("failed to serve metrics: %w", err)
+				}
+			}()
+		}
+
+		close(serving)
+		var serveErr error
+		select {
+		case sig := <-stopping:
+			logger.Info("shutting down", zap.String("signal", sig.String()), zap.Duration("timeout", shutdownTimeout))
+		case serveErr = <-serveErrs:
+			logger.Error("shutting down", zap.Error(serveErr))
 		}
 
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		timedOut := shutdown(shutdownCtx, logger, healthServer, grpcServer, httpServers, stopReconciler, reconcilerDone)
+
+		// Informers and cluster clients stop with ctx, the pool goes last as the drained requests used it
+		cancel()
+		pool.Close()
+
+		if serveErr != nil {
+			return exitError{code: exitFailure, err: serveErr}
+		}
+		if timedOut {
+			return exitError{code: exitShutdownTimeout, err: fmt.Errorf("shutdown timed out after %s", shutdownTimeout)}
+		}
+		logger.Info("shutdown complete")
 		return nil
 	},
 }
 
+// shutdown stops accepting requests, then waits for the servers to drain theirs and for the reconciler to finish
+// the current tenant, until ctx is done. timedOut tells whether they were stopped before they were done.
+// The HTTP servers are drained before the gRPC server, which serves the requests of the gateway.
+func shutdown(ctx context.Context, logger *zap.Logger, healthServer *grpchealth.Server, grpcServer *grpc.Server, httpServers []*http.Server, stopReconciler func(), reconcilerDone <-chan struct{}) bool {
+	healthServer.Shutdown()
+	stopReconciler()
+
+	serversDone := make(chan bool, 1)
+	go func() {
+		timedOut := false
+		for _, httpServer := range httpServers {
+			if err := httpServer.Shutdown(ctx); err != nil {
+				logger.Error("failed to drain HTTP server", zap.String("address", httpServer.Addr), zap.Error(err))
+				_ = httpServer.Close()
+				timedOut = true
+			}
+		}
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			logger.Error("failed to drain gRPC server", zap.Error(ctx.Err()))
+			grpcServer.Stop()
+			timedOut = true
+		}
+		serversDone <- timedOut
+	}()
+
+	reconcilerTimedOut := false
+	select {
+	case <-reconcilerDone:
+	case <-ctx.Done():
+		logger.Error("reconciler did not finish the current tenant", zap.Error(ctx.Err()))
+		reconcilerTimedOut = true
+	}
+	return <-serversDone || reconcilerTimedOut
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 	serveCmd.PersistentFlags().StringVar(&grpcAddr, "grpc-addr", ":8080", "gRPC address")
 	serveCmd.PersistentFlags().StringVar(&httpAddr, "http-addr", ":8081", "HTTP address")
 	serveCmd.PersistentFlags().StringVar(&dsn, "dsn", "", "PostgreSQL DSN")
+	serveCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", ":9090", "Address of the Prometheus metrics and the /log/level endpoint, empty to disable")
+	serveCmd.PersistentFlags().StringSliceVar(&trustedProxies, "trusted-proxies", nil, "CIDRs or IPs of the proxies trusted to set X-Forwarded-User and X-Forwarded-Email, the headers of other callers are ignored")
+	serveCmd.PersistentFlags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "How long in-flight requests and the current reconciliation get to finish on shutdown")
+	serveCmd.PersistentFlags().DurationVar(&reconcilerHeartbeatTimeout, "reconciler-heartbeat-timeout", 10*time.Minute, "How long the reconciler may go without starting or ending a pass, failed ones included, before /livez fails, 0 to disable")
+	serveCmd.PersistentFlags().StringVar(&traceOptions.Exporter, "trace-exporter", tracing.ExporterNone, "Exporter of traces (none, otlp, stdout)")
+	serveCmd.PersistentFlags().StringVar(&traceOptions.Endpoint, "otlp-endpoint", "", "OTLP gRPC endpoint traces are exported to, OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317 when empty")
+	serveCmd.PersistentFlags().BoolVar(&traceOptions.Insecure, "otlp-insecure", false, "Connect to the OTLP endpoint without TLS")
+	serveCmd.PersistentFlags().Float64Var(&traceOptions.SampleRatio, "trace-sample-ratio", 1, "Ratio of the traces started by the service that are sampled")
+	serveCmd.PersistentFlags().StringVar(&gitopsBackend, "gitops-backend", deploy.BackendArgoCD, "GitOps engine deploying tenants (argocd, flux, helm)")
+	serveCmd.PersistentFlags().StringVar(&chartCacheDir, "chart-cache-dir", filepath.Join(os.TempDir(), "poc-cloud-service-charts"), "Directory caching chart repositories for the helm backend")
+	serveCmd.PersistentFlags().StringVar(&secretKeyFile, "secret-key-file", "", "File with the base64 encoded 32 byte keys encrypting secret values, one per line, the first one encrypts new values")
+	serveCmd.PersistentFlags().StringVar(&driftMode, "drift-mode", reconciler.DriftModeCorrect, "What the reconciler does with tenant objects changed out of band (correct, report)")
+	serveCmd.PersistentFlags().StringVar(&orphanPolicy, "orphan-policy", reconciler.OrphanPolicyDelete, "What the reconciler does with tenant namespaces that have no tenant (delete, retain, report)")
+	serveCmd.PersistentFlags().DurationVar(&orphanGracePeriod, "orphan-grace-period", 10*time.Minute, "How long a tenant namespace without tenant is kept before it is deleted")
+	serveCmd.PersistentFlags().IntVar(&maxOrphanDeletions, "max-orphan-deletions", 5, "Tenant namespaces without tenant above which a reconciler pass deletes none, 0 for no limit")
+	serveCmd.PersistentFlags().IntVar(&maxOrphanDeletionPercent, "max-orphan-deletion-percent", 25, "Percentage of tenant namespaces without tenant above which a reconciler pass deletes none, 0 for no limit")
+	serveCmd.PersistentFlags().DurationVar(&eventRetention, "event-retention", 30*24*time.Hour, "How long tenant events are kept, 0 to keep them")
+	serveCmd.PersistentFlags().IntVar(&maxTenantEvents, "max-tenant-events", 100, "Tenant events kept per tenant, 0 for no limit")
 }
 
 type spaHandler struct {
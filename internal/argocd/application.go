@@ -13,15 +13,183 @@ type Application struct {
 	Status     Status            `json:"status"`
 }
 
-type ApplicationSpec struct {}
+type ApplicationSpec struct {
+	Source      *ApplicationSource  `json:"source"`
+	Sources     []ApplicationSource `json:"sources"`
+	Destination Destination         `json:"destination"`
+	SyncPolicy  *SyncPolicy         `json:"syncPolicy"`
+}
+
+type Destination struct {
+	Server    string `json:"server"`
+	Namespace string `json:"namespace"`
+}
+
+// ApplicationSource is a source of manifests, Helm, Kustomize and Directory are set by its type
+type ApplicationSource struct {
+	RepoURL        string                      `json:"repoURL"`
+	Path           string                      `json:"path"`
+	TargetRevision string                      `json:"targetRevision"`
+	Chart          string                      `json:"chart"`
+	Ref            string                      `json:"ref"`
+	Helm           *ApplicationSourceHelm      `json:"helm"`
+	Kustomize      *ApplicationSourceKustomize `json:"kustomize"`
+	Directory      *ApplicationSourceDirectory `json:"directory"`
+}
+
+type HelmParameter struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	ForceString bool   `json:"forceString"`
+}
+
+type HelmFileParameter struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// ApplicationSourceHelm holds values as YAML in Values, or as an object in ValuesObject
+type ApplicationSourceHelm struct {
+	ReleaseName    string                 `json:"releaseName"`
+	Values         string                 `json:"values"`
+	ValuesObject   map[string]interface{} `json:"valuesObject"`
+	ValueFiles     []string               `json:"valueFiles"`
+	Parameters     []HelmParameter        `json:"parameters"`
+	FileParameters []HelmFileParameter    `json:"fileParameters"`
+}
+
+type KustomizePatchTarget struct {
+	Group         string `json:"group"`
+	Version       string `json:"version"`
+	Kind          string `json:"kind"`
+	Name          string `json:"name"`
+	Namespace     string `json:"namespace"`
+	LabelSelector string `json:"labelSelector"`
+}
+
+type KustomizePatch struct {
+	Patch  string                `json:"patch"`
+	Path   string                `json:"path"`
+	Target *KustomizePatchTarget `json:"target"`
+}
+
+type ApplicationSourceKustomize struct {
+	Images       []string          `json:"images"`
+	NamePrefix   string            `json:"namePrefix"`
+	CommonLabels map[string]string `json:"commonLabels"`
+	Patches      []KustomizePatch  `json:"patches"`
+}
+
+type ApplicationSourceDirectory struct {
+	Recurse bool   `json:"recurse"`
+	Include string `json:"include"`
+	Exclude string `json:"exclude"`
+}
+
+type SyncPolicyAutomated struct {
+	Prune      bool `json:"prune"`
+	SelfHeal   bool `json:"selfHeal"`
+	AllowEmpty bool `json:"allowEmpty"`
+}
+
+type Backoff struct {
+	Duration    string `json:"duration"`
+	Factor      *int64 `json:"factor"`
+	MaxDuration string `json:"maxDuration"`
+}
+
+type RetryStrategy struct {
+	Limit   int64    `json:"limit"`
+	Backoff *Backoff `json:"backoff"`
+}
+
+type SyncPolicy struct {
+	Automated   *SyncPolicyAutomated `json:"automated"`
+	SyncOptions []string             `json:"syncOptions"`
+	Retry       *RetryStrategy       `json:"retry"`
+}
 
 type HealthStatus struct {
-	Status string `json:"status"`
+	Status  string `json:"status"`
 	Message string `json:"message"`
 }
 
+type SyncStatus struct {
+	Status    string   `json:"status"`
+	Revision  string   `json:"revision"`
+	Revisions []string `json:"revisions"`
+}
+
+// ResourceResult is the outcome of the sync of a resource
+type ResourceResult struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	HookPhase string `json:"hookPhase"`
+	SyncPhase string `json:"syncPhase"`
+}
+
+type SyncOperationResult struct {
+	Revision  string           `json:"revision"`
+	Revisions []string         `json:"revisions"`
+	Resources []ResourceResult `json:"resources"`
+}
+
+type OperationState struct {
+	Phase      string               `json:"phase"`
+	Message    string               `json:"message"`
+	SyncResult *SyncOperationResult `json:"syncResult"`
+	StartedAt  metav1.Time          `json:"startedAt"`
+	FinishedAt *metav1.Time         `json:"finishedAt"`
+	RetryCount int64                `json:"retryCount"`
+}
+
+type ApplicationCondition struct {
+	Type               string       `json:"type"`
+	Message            string       `json:"message"`
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime"`
+}
+
+type ApplicationSummary struct {
+	ExternalURLs []string `json:"externalURLs"`
+	Images       []string `json:"images"`
+}
+
+// RevisionHistory is a past sync of the application, Revisions is set for applications with several sources
+type RevisionHistory struct {
+	ID              int64        `json:"id"`
+	Revision        string       `json:"revision"`
+	Revisions       []string     `json:"revisions"`
+	DeployedAt      metav1.Time  `json:"deployedAt"`
+	DeployStartedAt *metav1.Time `json:"deployStartedAt"`
+}
+
+// ResourceStatus is a resource managed by the application
+type ResourceStatus struct {
+	Group           string        `json:"group"`
+	Version         string        `json:"version"`
+	Kind            string        `json:"kind"`
+	Namespace       string        `json:"namespace"`
+	Name            string        `json:"name"`
+	Status          string        `json:"status"`
+	Health          *HealthStatus `json:"health"`
+	Hook            bool          `json:"hook"`
+	RequiresPruning bool          `json:"requiresPruning"`
+}
+
 type Status struct {
-	Health HealthStatus `json:"health"`
+	Health         HealthStatus           `json:"health"`
+	Sync           SyncStatus             `json:"sync"`
+	OperationState *OperationState        `json:"operationState"`
+	Conditions     []ApplicationCondition `json:"conditions"`
+	Summary        ApplicationSummary     `json:"summary"`
+	History        []RevisionHistory      `json:"history"`
+	ReconciledAt   *metav1.Time           `json:"reconciledAt"`
+	Resources      []ResourceStatus       `json:"resources"`
 }
 
 func FromUnstructured(obj *unstructured.Unstructured) (*Application, error) {
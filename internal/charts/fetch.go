@@ -0,0 +1,299 @@
+package charts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"io/fs"
+	"os"
+	"path/filepath"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchInterval is how long a clone is used before fetching the remote again
+const fetchInterval = time.Minute
+
+const originHead = plumbing.ReferenceName("refs/remotes/origin/HEAD")
+
+// Fetcher loads tenant charts from their source, keeping git clones in a cache directory
+type Fetcher struct {
+	dir string
+	// mu guards the maps, repoLocks serialize the clone, fetch and checkout of each repository
+	mu         sync.Mutex
+	repoLocks  map[string]*sync.Mutex
+	lastFetch  map[string]time.Time
+	charts     map[string]cachedChart
+	localRepos map[string]string
+}
+
+// FetcherOption configures a Fetcher
+type FetcherOption func(*Fetcher)
+
+// WithLocalRepo reads repoURL from a local directory instead of cloning it.
+// It is meant for tests, tenant sources never point to the local filesystem.
+func WithLocalRepo(repoURL, dir string) FetcherOption {
+	return func(f *Fetcher) {
+		f.localRepos[repoURL] = dir
+	}
+}
+
+func NewFetcher(dir string, options ...FetcherOption) *Fetcher {
+	f := &Fetcher{
+		dir:        dir,
+		repoLocks:  map[string]*sync.Mutex{},
+		lastFetch:  map[string]time.Time{},
+		charts:     map[string]cachedChart{},
+		localRepos: map[string]string{},
+	}
+	for _, option := range options {
+		option(f)
+	}
+	return f
+}
+
+// Chart is a chart loaded from a tenant source
+type Chart struct {
+	*chart.Chart
+	// Revision is the commit or the chart version the chart was loaded from, empty for local directories
+	Revision string
+}
+
+// Load loads the chart of a source, cloning its repository or downloading it from its chart repository
+func (f *Fetcher) Load(ctx context.Context, source *v1.Source) (*Chart, error) {
+	if chartSource := source.GetChart(); chartSource != nil {
+		return f.loadChart(ctx, chartSource)
+	}
+
+	chartPath := source.GetPath()
+	if chartPath == "" {
+		chartPath = constants.DefaultRepoPath
+	}
+	if !filepath.IsLocal(chartPath) {
+		return nil, fmt.Errorf("path %s is outside of the repository", chartPath)
+	}
+	var loaded *Chart
+	err := f.withCheckout(ctx, source, func(dir, revision string) error {
+		chartDir, err := resolveInside(dir, chartPath)
+		if err != nil {
+			return err
+		}
+		// The helm loader follows symbolic links, which could point out of the checkout
+		if err := rejectSymlinks(chartDir); err != nil {
+			return err
+		}
+		c, err := loader.LoadDir(chartDir)
+		if err != nil {
+			return fmt.Errorf("failed to load chart: %w", err)
+		}
+		loaded = &Chart{Chart: c, Revision: revision}
+		return nil
+	})
+	return loaded, err
+}
+
+// ReadFile reads a file of a Git source, relative to the repository root
+func (f *Fetcher) ReadFile(ctx context.Context, source *v1.Source, name string) ([]byte, error) {
+	if source.GetChart() != nil {
+		return nil, fmt.Errorf("cannot read %s from a chart source", name)
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("path %s is outside of the repository", name)
+	}
+	var data []byte
+	err := f.withCheckout(ctx, source, func(dir, revision string) error {
+		file, err := resolveInside(dir, name)
+		if err != nil {
+			return err
+		}
+		data, err = os.ReadFile(file)
+		return err
+	})
+	return data, err
+}
+
+// resolveInside resolves the symbolic links of a path relative to the checkout in dir, failing if it ends up outside
+func resolveInside(dir, name string) (string, error) {
+	root, err := resolveDir(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := resolveDir(filepath.Join(root, name))
+	if err != nil {
+		return "", err
+	}
+	if !insideDir(root, resolved) {
+		return "", fmt.Errorf("path %s is outside of the repository", name)
+	}
+	return resolved, nil
+}
+
+// rejectSymlinks fails when the tree under dir holds a symbolic link
+func rejectSymlinks(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			rel, _ := filepath.Rel(dir, path)
+			return fmt.Errorf("chart file %s is a symbolic link", rel)
+		}
+		return nil
+	})
+}
+
+// withCheckout calls fn with the repository of a Git source checked out at its target revision
+func (f *Fetcher) withCheckout(ctx context.Context, source *v1.Source, fn func(dir, revision string) error) error {
+	repoURL := source.GetRepoUrl()
+	if repoURL == "" {
+		repoURL = constants.DefaultRepoURL
+	}
+	if dir, ok := f.localRepos[repoURL]; ok {
+		return fn(dir, "")
+	}
+
+	// The worktree is shared by every revision of a repository, keep it checked out until fn returns
+	lock := f.repoLock(repoURL)
+	lock.Lock()
+	defer lock.Unlock()
+
+	repo, dir, err := f.sync(ctx, repoURL)
+	if err != nil {
+		return err
+	}
+	hash, err := resolve(repo, source.GetTargetRevision())
+	if err != nil {
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return fmt.Errorf("failed to checkout %s: %w", hash, err)
+	}
+	return fn(dir, hash.String())
+}
+
+// repoLock returns the lock of a repository, other repositories are fetched meanwhile
+func (f *Fetcher) repoLock(repoURL string) *sync.Mutex {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lock, ok := f.repoLocks[repoURL]
+	if !ok {
+		lock = &sync.Mutex{}
+		f.repoLocks[repoURL] = lock
+	}
+	return lock
+}
+
+// fetched records when the clone in dir was last fetched
+func (f *Fetcher) fetched(dir string, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastFetch[dir] = at
+}
+
+// fetchedAt returns when the clone in dir was last fetched
+func (f *Fetcher) fetchedAt(dir string) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastFetch[dir]
+}
+
+// sync clones the repository into the cache, or fetches it if the last fetch is older than fetchInterval
+func (f *Fetcher) sync(ctx context.Context, repoURL string) (*git.Repository, string, error) {
+	l := log.FromContext(ctx).With(zap.String("repo", repoURL))
+	sum := sha256.Sum256([]byte(repoURL))
+	dir := filepath.Join(f.dir, hex.EncodeToString(sum[:8]))
+
+	repo, err := git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		l.Info("Cloning repository")
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, "", err
+		}
+		repo, err = git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{URL: repoURL})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to clone %s: %w", repoURL, err)
+		}
+		// Remember the default branch, the worktree HEAD is detached by later checkouts
+		head, err := repo.Head()
+		if err != nil {
+			return nil, "", err
+		}
+		ref := plumbing.NewSymbolicReference(originHead, plumbing.NewRemoteReferenceName("origin", head.Name().Short()))
+		if err := repo.Storer.SetReference(ref); err != nil {
+			return nil, "", err
+		}
+		f.fetched(dir, time.Now())
+		return repo, dir, nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open clone of %s: %w", repoURL, err)
+	}
+
+	if time.Since(f.fetchedAt(dir)) < fetchInterval {
+		return repo, dir, nil
+	}
+	l.Info("Fetching repository")
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"+refs/tags/*:refs/tags/*",
+		},
+		Force: true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, "", fmt.Errorf("failed to fetch %s: %w", repoURL, err)
+	}
+	f.fetched(dir, time.Now())
+	return repo, dir, nil
+}
+
+// resolve resolves a target revision the way Argo CD does: a branch, a tag or a commit, the default branch if empty
+func resolve(repo *git.Repository, revision string) (plumbing.Hash, error) {
+	if revision == "" || revision == "HEAD" {
+		ref, err := repo.Reference(originHead, true)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to resolve default branch: %w", err)
+		}
+		return ref.Hash(), nil
+	}
+	// branches are only fetched as remote references
+	if branch, ok := strings.CutPrefix(revision, "refs/heads/"); ok {
+		revision = string(plumbing.NewRemoteReferenceName("origin", branch))
+	}
+	candidates := []string{
+		string(plumbing.NewRemoteReferenceName("origin", revision)),
+		string(plumbing.NewTagReferenceName(revision)),
+		revision,
+	}
+	for _, candidate := range candidates {
+		if hash, err := repo.ResolveRevision(plumbing.Revision(candidate)); err == nil {
+			return *hash, nil
+		}
+	}
+	return plumbing.ZeroHash, fmt.Errorf("revision %q not found", revision)
+}
+
+// ValueFileRef splits a $<ref>/<path> value file into the source it reads from and the path in that source
+func ValueFileRef(valueFile string) (string, string, bool) {
+	if !strings.HasPrefix(valueFile, "$") {
+		return "", "", false
+	}
+	ref, path, _ := strings.Cut(valueFile[1:], "/")
+	return ref, path, true
+}
@@ -0,0 +1,263 @@
+package charts
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	v1 "poc-cloud-service/gen/api/v1"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// kustomizeBuild builds the kustomization in root, a directory of the repository checked out in repo, with the options
+// of a source. The options are applied to the kustomization like Argo CD edits it, without writing to the checkout.
+// Files are only read from the kustomization roots and from the checkout.
+func kustomizeBuild(repo, root string, options *v1.Kustomize) (string, error) {
+	fSys, err := newCheckoutFs(repo)
+	if err != nil {
+		return "", err
+	}
+	if !fSys.inside(root) {
+		return "", fmt.Errorf("path %s is outside of the repository", root)
+	}
+	if err := fSys.editKustomization(root, options); err != nil {
+		return "", err
+	}
+
+	opts := krusty.MakeDefaultOptions()
+	opts.LoadRestrictions = types.LoadRestrictionsRootOnly
+	resources, err := krusty.MakeKustomizer(opts).Run(fSys, root)
+	if err != nil {
+		return "", fmt.Errorf("failed to build kustomization: %w", err)
+	}
+	manifest, err := resources.AsYaml()
+	if err != nil {
+		return "", err
+	}
+	return string(manifest), nil
+}
+
+// editKustomization overrides the kustomization file of root with the options applied, the way kustomize edit does
+func (c *checkoutFs) editKustomization(root string, options *v1.Kustomize) error {
+	if len(options.GetImages()) == 0 && options.GetNamePrefix() == "" && len(options.GetCommonLabels()) == 0 && len(options.GetPatches()) == 0 {
+		return nil
+	}
+	var file string
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if c.Exists(filepath.Join(root, name)) {
+			file = filepath.Join(root, name)
+			break
+		}
+	}
+	if file == "" {
+		return fmt.Errorf("no kustomization file in %s", root)
+	}
+	data, err := c.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	kustomization := types.Kustomization{}
+	if err := yaml.Unmarshal(data, &kustomization); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filepath.Base(file), err)
+	}
+
+	if prefix := options.GetNamePrefix(); prefix != "" {
+		kustomization.NamePrefix = prefix
+	}
+	if len(options.GetCommonLabels()) > 0 && kustomization.CommonLabels == nil {
+		kustomization.CommonLabels = map[string]string{}
+	}
+	for k, v := range options.GetCommonLabels() {
+		kustomization.CommonLabels[k] = v
+	}
+	for _, image := range options.GetImages() {
+		kustomization.Images = setImage(kustomization.Images, parseImage(image))
+	}
+	for _, patch := range options.GetPatches() {
+		p := types.Patch{Patch: patch.GetPatch()}
+		if patch.GetPath() != "" {
+			if !filepath.IsLocal(patch.GetPath()) {
+				return fmt.Errorf("patch %s is outside of the source", patch.GetPath())
+			}
+			p.Path = patch.GetPath()
+		}
+		if target := patch.GetTarget(); target != nil {
+			p.Target = &types.Selector{
+				ResId: resid.ResId{
+					Gvk:       resid.Gvk{Group: target.GetGroup(), Version: target.GetVersion(), Kind: target.GetKind()},
+					Name:      target.GetName(),
+					Namespace: target.GetNamespace(),
+				},
+				LabelSelector: target.GetLabelSelector(),
+			}
+		}
+		kustomization.Patches = append(kustomization.Patches, p)
+	}
+	if data, err = yaml.Marshal(kustomization); err != nil {
+		return err
+	}
+	c.override(file, data)
+	return nil
+}
+
+// setImage replaces the override of an image, or adds it
+func setImage(images []types.Image, image types.Image) []types.Image {
+	for i := range images {
+		if images[i].Name == image.Name {
+			images[i] = image
+			return images
+		}
+	}
+	return append(images, image)
+}
+
+// checkoutFs is the checkout of a repository as a kustomize file system. It is read only, paths resolving outside of
+// the checkout do not exist, and files can be overridden in memory.
+type checkoutFs struct {
+	filesys.FileSystem
+	repo  string
+	files map[string][]byte
+}
+
+func newCheckoutFs(repo string) (*checkoutFs, error) {
+	repo, err := resolveDir(repo)
+	if err != nil {
+		return nil, err
+	}
+	return &checkoutFs{FileSystem: filesys.MakeFsOnDisk(), repo: repo, files: map[string][]byte{}}, nil
+}
+
+// inside tells whether a path resolves inside of the checkout, symbolic links followed
+func (c *checkoutFs) inside(path string) bool {
+	return insideDir(c.repo, path)
+}
+
+func (c *checkoutFs) override(path string, data []byte) {
+	c.files[c.key(path)] = data
+}
+
+// key is the path overrides are stored at, resolved like kustomize resolves its roots
+func (c *checkoutFs) key(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+func (c *checkoutFs) Create(path string) (filesys.File, error) {
+	return nil, errReadOnly
+}
+
+func (c *checkoutFs) Mkdir(path string) error {
+	return errReadOnly
+}
+
+func (c *checkoutFs) MkdirAll(path string) error {
+	return errReadOnly
+}
+
+func (c *checkoutFs) RemoveAll(path string) error {
+	return errReadOnly
+}
+
+func (c *checkoutFs) WriteFile(path string, data []byte) error {
+	return errReadOnly
+}
+
+func (c *checkoutFs) Open(path string) (filesys.File, error) {
+	if !c.inside(path) {
+		return nil, outsideError(path)
+	}
+	return c.FileSystem.Open(path)
+}
+
+func (c *checkoutFs) IsDir(path string) bool {
+	return c.inside(path) && c.FileSystem.IsDir(path)
+}
+
+func (c *checkoutFs) ReadDir(path string) ([]string, error) {
+	if !c.inside(path) {
+		return nil, outsideError(path)
+	}
+	return c.FileSystem.ReadDir(path)
+}
+
+func (c *checkoutFs) Exists(path string) bool {
+	if _, ok := c.files[c.key(path)]; ok {
+		return true
+	}
+	return c.inside(path) && c.FileSystem.Exists(path)
+}
+
+func (c *checkoutFs) Glob(pattern string) ([]string, error) {
+	matches, err := c.FileSystem.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var inside []string
+	for _, match := range matches {
+		if c.inside(match) {
+			inside = append(inside, match)
+		}
+	}
+	return inside, nil
+}
+
+func (c *checkoutFs) ReadFile(path string) ([]byte, error) {
+	if data, ok := c.files[c.key(path)]; ok {
+		return data, nil
+	}
+	if !c.inside(path) {
+		return nil, outsideError(path)
+	}
+	return c.FileSystem.ReadFile(path)
+}
+
+func (c *checkoutFs) Walk(path string, walkFn filepath.WalkFunc) error {
+	if !c.inside(path) {
+		return outsideError(path)
+	}
+	return c.FileSystem.Walk(path, func(name string, info fs.FileInfo, err error) error {
+		if err == nil && !c.inside(name) {
+			return walkFn(name, info, outsideError(name))
+		}
+		return walkFn(name, info, err)
+	})
+}
+
+var errReadOnly = errors.New("the checkout is read only")
+
+func outsideError(path string) error {
+	return fmt.Errorf("%s is outside of the repository", path)
+}
+
+// parseImage parses an image override the way kustomize edit set image does: name=new-name:tag, name:tag or name@digest
+func parseImage(image string) types.Image {
+	name, override, renamed := strings.Cut(image, "=")
+	if !renamed {
+		override = image
+	}
+	ret := types.Image{Name: name}
+	newName := override
+	if i := strings.Index(override, "@"); i >= 0 {
+		newName, ret.Digest = override[:i], override[i+1:]
+	} else if i := strings.LastIndex(override, ":"); i > strings.LastIndex(override, "/") {
+		newName, ret.NewTag = override[:i], override[i+1:]
+	}
+	if renamed {
+		ret.NewName = newName
+	} else {
+		ret.Name = newName
+	}
+	return ret
+}
@@ -0,0 +1,206 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"io/fs"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"os"
+	"path/filepath"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strings"
+)
+
+// Render templates a source locally the way the GitOps engine does, as a release called releaseName in namespace.
+// It returns the objects with the revision they were rendered from.
+func (f *Fetcher) Render(ctx context.Context, source *v1.Source, sources []*v1.Source, releaseName, namespace string) ([]*unstructured.Unstructured, string, error) {
+	switch source.GetType() {
+	case v1.SourceType_SOURCE_TYPE_KUSTOMIZE:
+		return f.renderPath(ctx, source, func(repo, root string) ([]*unstructured.Unstructured, error) {
+			manifest, err := kustomizeBuild(repo, root, source.GetKustomize())
+			if err != nil {
+				return nil, err
+			}
+			return ParseManifests(manifest)
+		})
+	case v1.SourceType_SOURCE_TYPE_DIRECTORY:
+		return f.renderPath(ctx, source, func(repo, root string) ([]*unstructured.Unstructured, error) {
+			return readDirectory(repo, root, source.GetDirectory())
+		})
+	}
+	c, err := f.Load(ctx, source)
+	if err != nil {
+		return nil, "", err
+	}
+	values, err := f.Values(ctx, source, sources, c.Chart)
+	if err != nil {
+		return nil, "", err
+	}
+	objects, err := RenderChart(ctx, c.Chart, values, releaseName, namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	return objects, c.Revision, nil
+}
+
+// renderPath renders the path of a Git source with its repository checked out in repo
+func (f *Fetcher) renderPath(ctx context.Context, source *v1.Source, render func(repo, root string) ([]*unstructured.Unstructured, error)) ([]*unstructured.Unstructured, string, error) {
+	sourcePath := source.GetPath()
+	if sourcePath == "" {
+		sourcePath = constants.DefaultRepoPath
+	}
+	if !filepath.IsLocal(sourcePath) {
+		return nil, "", fmt.Errorf("path %s is outside of the repository", sourcePath)
+	}
+	var objects []*unstructured.Unstructured
+	var revision string
+	err := f.withCheckout(ctx, source, func(dir, rev string) error {
+		var err error
+		objects, err = render(dir, filepath.Join(dir, sourcePath))
+		revision = rev
+		return err
+	})
+	return objects, revision, err
+}
+
+// readDirectory reads the YAML and JSON files of a directory source in the checkout repo, in lexical order.
+// Symbolic links resolving outside of the checkout are rejected.
+func readDirectory(repo, root string, options *v1.Directory) ([]*unstructured.Unstructured, error) {
+	repo, err := resolveDir(repo)
+	if err != nil {
+		return nil, err
+	}
+	if !insideDir(repo, root) {
+		return nil, fmt.Errorf("path %s is outside of the repository", root)
+	}
+	var objects []*unstructured.Unstructured
+	err = filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if name != root && (!options.GetRecurse() || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch filepath.Ext(name) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		if options.GetInclude() != "" && !matchGlob(options.GetInclude(), rel) {
+			return nil
+		}
+		if options.GetExclude() != "" && matchGlob(options.GetExclude(), rel) {
+			return nil
+		}
+		if !insideDir(repo, name) {
+			return fmt.Errorf("%s links outside of the repository", rel)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		fileObjects, err := ParseManifests(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		objects = append(objects, fileObjects...)
+		return nil
+	})
+	return objects, err
+}
+
+// resolveDir returns the absolute path of a directory, free of symbolic links
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// insideDir tells whether path resolves inside of dir, as returned by resolveDir
+func insideDir(dir, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	return abs == dir || strings.HasPrefix(abs, dir+string(filepath.Separator))
+}
+
+// matchGlob matches a path or its file name against a glob, which may list alternatives as {a,b}
+func matchGlob(pattern, name string) bool {
+	patterns := []string{pattern}
+	if strings.HasPrefix(pattern, "{") && strings.HasSuffix(pattern, "}") {
+		patterns = strings.Split(pattern[1:len(pattern)-1], ",")
+	}
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(p, filepath.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderChart templates a chart without a cluster, as a release called releaseName in namespace.
+// Hooks are left out, they are not part of the release once it is deployed.
+func RenderChart(ctx context.Context, c *chart.Chart, values map[string]interface{}, releaseName, namespace string) ([]*unstructured.Unstructured, error) {
+	install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.IncludeCRDs = true
+	install.ReleaseName = releaseName
+	install.Namespace = namespace
+	rel, err := install.RunWithContext(ctx, c, values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart: %w", err)
+	}
+	return ParseManifests(rel.Manifest)
+}
+
+// ParseManifests parses a multi-document YAML manifest, in the order of its documents
+func ParseManifests(manifest string) ([]*unstructured.Unstructured, error) {
+	manifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(manifests))
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var objects []*unstructured.Unstructured
+	for _, key := range keys {
+		jsonBytes, err := yaml.YAMLToJSON([]byte(manifests[key]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if string(jsonBytes) == "null" {
+			continue
+		}
+		// The unstructured decoder keeps integers as int64, like objects read from a cluster
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(jsonBytes); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
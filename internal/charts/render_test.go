@@ -0,0 +1,284 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"os"
+	"path/filepath"
+	v1 "poc-cloud-service/gen/api/v1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRepoURL = "https://git.example.com/tenants"
+
+func TestRender(t *testing.T) {
+	values, err := structpb.NewStruct(map[string]interface{}{"greeting": "bonjour"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretValues, err := structpb.NewStruct(map[string]interface{}{"greeting": "secret", "replicas": 3.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		source *v1.Source
+		// objects are the rendered objects as kind/name, fields are checked on the first one
+		objects []string
+		fields  map[string]string
+	}{
+		{
+			name: "helm chart",
+			source: &v1.Source{
+				RepoUrl: testRepoURL,
+				Path:    "chart",
+				Helm: &v1.Helm{
+					Values:     values,
+					Parameters: []*v1.HelmParameter{{Name: "replicas", Value: "2"}},
+				},
+			},
+			objects: []string{"ConfigMap/release-greeting"},
+			fields: map[string]string{
+				"metadata.namespace": "tenant-ns",
+				"data.greeting":      "bonjour",
+				"data.replicas":      "2",
+			},
+		},
+		{
+			// The GitOps engines merge secret values under inline values, which parameters override
+			name: "helm chart secret values",
+			source: &v1.Source{
+				RepoUrl: testRepoURL,
+				Path:    "chart",
+				Helm: &v1.Helm{
+					Values:       values,
+					SecretValues: secretValues,
+				},
+			},
+			objects: []string{"ConfigMap/release-greeting"},
+			fields: map[string]string{
+				"data.greeting": "bonjour",
+				"data.replicas": "3",
+			},
+		},
+		{
+			name: "helm chart parameters over secret values",
+			source: &v1.Source{
+				RepoUrl: testRepoURL,
+				Path:    "chart",
+				Helm: &v1.Helm{
+					SecretValues: secretValues,
+					Parameters:   []*v1.HelmParameter{{Name: "replicas", Value: "2"}},
+				},
+			},
+			objects: []string{"ConfigMap/release-greeting"},
+			fields: map[string]string{
+				"data.greeting": "secret",
+				"data.replicas": "2",
+			},
+		},
+		{
+			name: "directory",
+			source: &v1.Source{
+				RepoUrl: testRepoURL,
+				Path:    "manifests",
+				Type:    v1.SourceType_SOURCE_TYPE_DIRECTORY,
+			},
+			objects: []string{"ConfigMap/top", "Service/web"},
+		},
+		{
+			name: "recursive directory",
+			source: &v1.Source{
+				RepoUrl:   testRepoURL,
+				Path:      "manifests",
+				Type:      v1.SourceType_SOURCE_TYPE_DIRECTORY,
+				Directory: &v1.Directory{Recurse: true, Exclude: "*.json"},
+			},
+			objects: []string{"ConfigMap/top", "Secret/nested"},
+		},
+		{
+			name: "directory include",
+			source: &v1.Source{
+				RepoUrl:   testRepoURL,
+				Path:      "manifests",
+				Type:      v1.SourceType_SOURCE_TYPE_DIRECTORY,
+				Directory: &v1.Directory{Recurse: true, Include: "{service.json,nested/*.yaml}"},
+			},
+			objects: []string{"Secret/nested", "Service/web"},
+		},
+		{
+			name: "kustomize",
+			source: &v1.Source{
+				RepoUrl: testRepoURL,
+				Path:    "kustomize/overlay",
+				Type:    v1.SourceType_SOURCE_TYPE_KUSTOMIZE,
+			},
+			objects: []string{"Deployment/web"},
+			fields:  map[string]string{"spec.replicas": "1"},
+		},
+		{
+			name: "kustomize options",
+			source: &v1.Source{
+				RepoUrl: testRepoURL,
+				Path:    "kustomize/overlay",
+				Type:    v1.SourceType_SOURCE_TYPE_KUSTOMIZE,
+				Kustomize: &v1.Kustomize{
+					Images:       []string{"nginx:1.27"},
+					NamePrefix:   "prod-",
+					CommonLabels: map[string]string{"env": "prod"},
+					Patches:      []*v1.KustomizePatch{{Path: "patches/replicas.yaml"}},
+				},
+			},
+			objects: []string{"Deployment/prod-web"},
+			fields: map[string]string{
+				"metadata.labels.env": "prod",
+				"spec.replicas":       "3",
+			},
+		},
+	}
+	f := NewFetcher(t.TempDir(), WithLocalRepo(testRepoURL, "testdata/repo"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, _, err := f.Render(context.Background(), tt.source, nil, "release", "tenant-ns")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, obj := range objects {
+				got = append(got, obj.GetKind()+"/"+obj.GetName())
+			}
+			if !reflect.DeepEqual(got, tt.objects) {
+				t.Fatalf("Render() = %q, want %q", got, tt.objects)
+			}
+			for path, want := range tt.fields {
+				value, _, _ := unstructured.NestedFieldNoCopy(objects[0].Object, strings.Split(path, ".")...)
+				if got := fmt.Sprint(value); got != want {
+					t.Errorf("%s = %s, want %s", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestRenderKustomizeImage checks the image override, kept out of TestRender as it sits in a list
+func TestRenderKustomizeImage(t *testing.T) {
+	f := NewFetcher(t.TempDir(), WithLocalRepo(testRepoURL, "testdata/repo"))
+	objects, _, err := f.Render(context.Background(), &v1.Source{
+		RepoUrl:   testRepoURL,
+		Path:      "kustomize/overlay",
+		Type:      v1.SourceType_SOURCE_TYPE_KUSTOMIZE,
+		Kustomize: &v1.Kustomize{Images: []string{"nginx=registry.example.com/nginx:1.27"}},
+	}, nil, "release", "tenant-ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers, _, _ := unstructured.NestedSlice(objects[0].Object, "spec", "template", "spec", "containers")
+	if image := containers[0].(map[string]interface{})["image"]; image != "registry.example.com/nginx:1.27" {
+		t.Errorf("image = %v", image)
+	}
+}
+
+// TestRenderOutsideOfRepository checks that symbolic links cannot read files out of the checkout
+func TestRenderOutsideOfRepository(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.yaml"), []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: host\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	repo := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(name, target string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, filepath.Join(repo, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("manifests/configmap.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: top\n")
+	link("manifests/secret.yaml", filepath.Join(outside, "secret.yaml"))
+	write("inside/configmap.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: inside\n")
+	link("manifests/inside.yaml", "../inside/configmap.yaml")
+	link("linked", outside)
+	write("kustomize/kustomization.yaml", "resources:\n  - secret.yaml\n")
+	link("kustomize/secret.yaml", filepath.Join(outside, "secret.yaml"))
+	write("kustomize-patch/kustomization.yaml", "resources:\n  - configmap.yaml\n")
+	write("kustomize-patch/configmap.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: top\n")
+	link("kustomize-patch/patch.yaml", filepath.Join(outside, "secret.yaml"))
+	write("chart/Chart.yaml", "apiVersion: v2\nname: chart\nversion: 0.1.0\n")
+	link("chart/templates/secret.yaml", filepath.Join(outside, "secret.yaml"))
+	write("inside-chart/Chart.yaml", "apiVersion: v2\nname: chart\nversion: 0.1.0\n")
+	link("inside-chart/templates", "../inside")
+	write("values/Chart.yaml", "apiVersion: v2\nname: values\nversion: 0.1.0\n")
+	link("values/values-linked.yaml", filepath.Join(outside, "secret.yaml"))
+	link("values-linked.yaml", filepath.Join(outside, "secret.yaml"))
+	write("clean/Chart.yaml", "apiVersion: v2\nname: clean\nversion: 0.1.0\n")
+
+	f := NewFetcher(t.TempDir(), WithLocalRepo(testRepoURL, repo))
+	tests := []struct {
+		name    string
+		source  *v1.Source
+		sources []*v1.Source
+	}{
+		{name: "directory file", source: &v1.Source{RepoUrl: testRepoURL, Path: "manifests", Type: v1.SourceType_SOURCE_TYPE_DIRECTORY}},
+		{name: "directory path", source: &v1.Source{RepoUrl: testRepoURL, Path: "linked", Type: v1.SourceType_SOURCE_TYPE_DIRECTORY}},
+		{name: "kustomize resource", source: &v1.Source{RepoUrl: testRepoURL, Path: "kustomize", Type: v1.SourceType_SOURCE_TYPE_KUSTOMIZE}},
+		{name: "kustomize path", source: &v1.Source{RepoUrl: testRepoURL, Path: "linked", Type: v1.SourceType_SOURCE_TYPE_KUSTOMIZE}},
+		{name: "kustomize patch", source: &v1.Source{
+			RepoUrl:   testRepoURL,
+			Path:      "kustomize-patch",
+			Type:      v1.SourceType_SOURCE_TYPE_KUSTOMIZE,
+			Kustomize: &v1.Kustomize{Patches: []*v1.KustomizePatch{{Path: "patch.yaml"}}},
+		}},
+		{name: "chart template", source: &v1.Source{RepoUrl: testRepoURL, Path: "chart"}},
+		{name: "chart path", source: &v1.Source{RepoUrl: testRepoURL, Path: "linked"}},
+		// Links are rejected anywhere in a chart, the helm loader does not tell where they lead
+		{name: "chart link inside of the checkout", source: &v1.Source{RepoUrl: testRepoURL, Path: "inside-chart"}},
+		{name: "chart value file", source: &v1.Source{
+			RepoUrl: testRepoURL,
+			Path:    "values",
+			Helm:    &v1.Helm{ValueFiles: []string{"values-linked.yaml"}},
+		}},
+		{
+			name: "value file of another source",
+			source: &v1.Source{
+				RepoUrl: testRepoURL,
+				Path:    "clean",
+				Helm:    &v1.Helm{ValueFiles: []string{"$config/values-linked.yaml"}},
+			},
+			sources: []*v1.Source{{RepoUrl: testRepoURL, Ref: "config"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, _, err := f.Render(context.Background(), tt.source, tt.sources, "release", "tenant-ns")
+			if err == nil {
+				t.Fatalf("expected an error, got %d objects", len(objects))
+			}
+		})
+	}
+
+	// Links inside of the checkout are followed
+	if err := os.Remove(filepath.Join(repo, "manifests/secret.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	objects, _, err := f.Render(context.Background(), tests[0].source, nil, "release", "tenant-ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("expected the linked file to be read, got %d objects", len(objects))
+	}
+}
@@ -0,0 +1,85 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	"io"
+	"os"
+	"path/filepath"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/log"
+	"strings"
+	"time"
+)
+
+type cachedChart struct {
+	chart   *Chart
+	fetched time.Time
+}
+
+// loadChart downloads a chart from a Helm repository or an OCI registry.
+// Charts are kept for fetchInterval, after which the version constraint is resolved again.
+func (f *Fetcher) loadChart(ctx context.Context, source *v1.ChartSource) (*Chart, error) {
+	key := source.GetRepoUrl() + "|" + source.GetName() + "|" + source.GetVersion()
+	f.mu.Lock()
+	cached, ok := f.charts[key]
+	f.mu.Unlock()
+	if ok && time.Since(cached.fetched) < fetchInterval {
+		return cached.chart, nil
+	}
+
+	log.FromContext(ctx).Info("Downloading chart", zap.String("repo", source.GetRepoUrl()), zap.String("chart", source.GetName()), zap.String("version", source.GetVersion()))
+	dest := filepath.Join(f.dir, "charts")
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return nil, err
+	}
+
+	registryClient, err := registry.NewClient(registry.ClientOptWriter(io.Discard))
+	if err != nil {
+		return nil, err
+	}
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(f.dir, "repositories.yaml")
+	settings.RepositoryCache = filepath.Join(f.dir, "repository")
+	getters := getter.All(settings)
+
+	var ref string
+	if registry.IsOCI(source.GetRepoUrl()) {
+		ref = strings.TrimSuffix(source.GetRepoUrl(), "/") + "/" + source.GetName()
+	} else {
+		ref, err = repo.FindChartInRepoURL(source.GetRepoUrl(), source.GetName(), source.GetVersion(), "", "", "", getters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find chart: %w", err)
+		}
+	}
+
+	dl := downloader.ChartDownloader{
+		Out:              io.Discard,
+		Getters:          getters,
+		Options:          []getter.Option{getter.WithRegistryClient(registryClient)},
+		RegistryClient:   registryClient,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+	archive, _, err := dl.DownloadTo(ref, source.GetVersion(), dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download chart: %w", err)
+	}
+	c, err := loader.Load(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	loaded := &Chart{Chart: c, Revision: c.Metadata.Version}
+	f.mu.Lock()
+	f.charts[key] = cachedChart{chart: loaded, fetched: time.Now()}
+	f.mu.Unlock()
+	return loaded, nil
+}
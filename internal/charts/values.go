@@ -0,0 +1,102 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+	"path"
+	v1 "poc-cloud-service/gen/api/v1"
+)
+
+// Values builds the values of a helm source the way the GitOps engines do: value files in order, then secret values,
+// then inline values, then parameters. Value files of other sources are read from sources, by ref.
+func (f *Fetcher) Values(ctx context.Context, source *v1.Source, sources []*v1.Source, c *chart.Chart) (map[string]interface{}, error) {
+	refs := map[string]*v1.Source{}
+	for _, s := range sources {
+		if s.GetRef() != "" {
+			refs[s.GetRef()] = s
+		}
+	}
+
+	helm := source.GetHelm()
+	values := map[string]interface{}{}
+	for _, valueFile := range helm.GetValueFiles() {
+		var data []byte
+		if ref, name, ok := ValueFileRef(valueFile); ok {
+			refSource, ok := refs[ref]
+			if !ok {
+				return nil, fmt.Errorf("value file %s references unknown source %s", valueFile, ref)
+			}
+			var err error
+			if data, err = f.ReadFile(ctx, refSource, name); err != nil {
+				return nil, fmt.Errorf("failed to read value file %s: %w", valueFile, err)
+			}
+		} else if data = chartFile(c, valueFile); data == nil {
+			return nil, fmt.Errorf("value file %s not found in chart", valueFile)
+		}
+		fileValues, err := chartutil.ReadValues(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse value file %s: %w", valueFile, err)
+		}
+		values = MergeValues(values, fileValues)
+	}
+	// Flux merges valuesFrom, which holds the secret values, before the inline values
+	values = MergeValues(values, helm.GetSecretValues().AsMap())
+	values = MergeValues(values, helm.GetValues().AsMap())
+	if err := ApplyParameters(values, helm.GetParameters()); err != nil {
+		return nil, err
+	}
+	for _, parameter := range helm.GetFileParameters() {
+		data := chartFile(c, parameter.GetPath())
+		if data == nil {
+			return nil, fmt.Errorf("file parameter %s not found in chart", parameter.GetPath())
+		}
+		reader := func([]rune) (interface{}, error) { return string(data), nil }
+		if err := strvals.ParseIntoFile(parameter.GetName()+"="+parameter.GetPath(), values, reader); err != nil {
+			return nil, fmt.Errorf("failed to set file parameter %s: %w", parameter.GetName(), err)
+		}
+	}
+	return values, nil
+}
+
+// MergeValues merges src into dst the way helm merges values files, src wins and maps are merged recursively
+func MergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				dst[k] = MergeValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// ApplyParameters sets helm parameters on values, like --set and --set-string
+func ApplyParameters(values map[string]interface{}, parameters []*v1.HelmParameter) error {
+	for _, parameter := range parameters {
+		set := parameter.GetName() + "=" + parameter.GetValue()
+		parse := strvals.ParseInto
+		if parameter.GetForceString() {
+			parse = strvals.ParseIntoString
+		}
+		if err := parse(set, values); err != nil {
+			return fmt.Errorf("failed to set parameter %s: %w", parameter.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// chartFile returns a file of the chart by its path relative to the chart root, nil if it does not exist
+func chartFile(c *chart.Chart, name string) []byte {
+	name = path.Clean(name)
+	for _, f := range c.Raw {
+		if f.Name == name {
+			return f.Data
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/store"
+	"poc-cloud-service/internal/tracing"
+	"poc-cloud-service/log"
+	"sync"
+)
+
+// Target is a cluster tenants can be placed on
+type Target struct {
+	// ID is the registered cluster id, empty for the local cluster
+	ID string
+	// Server is the API server address used as the Argo CD destination
+	Server string
+	// KubeconfigSecret is the secret holding the cluster kubeconfig, empty for the local cluster
+	KubeconfigSecret string
+	// Config is the rest config Client was built from
+	Config *rest.Config
+	Client kubernetes.Interface
+}
+
+type cachedClient struct {
+	resourceVersion string
+	config          *rest.Config
+	client          kubernetes.Interface
+}
+
+// Registry builds clients for the clusters registered in the store
+type Registry struct {
+	local       kubernetes.Interface
+	localConfig *rest.Config
+	store       *store.Queries
+	mu          sync.Mutex
+	clients     map[string]cachedClient
+}
+
+func NewRegistry(local kubernetes.Interface, localConfig *rest.Config, store *store.Queries) *Registry {
+	return &Registry{
+		local:       local,
+		localConfig: localConfig,
+		store:       store,
+		clients:     map[string]cachedClient{},
+	}
+}
+
+// Local returns the target for the cluster the service runs in
+func (r *Registry) Local() *Target {
+	return &Target{
+		Server: constants.InClusterServer,
+		Config: r.localConfig,
+		Client: r.local,
+	}
+}
+
+// Targets returns the local cluster and every registered cluster, keyed by cluster id.
+// Clusters whose credentials cannot be loaded are logged and left out.
+func (r *Registry) Targets(ctx context.Context) (map[string]*Target, error) {
+	l := log.FromContext(ctx)
+
+	clusters, err := r.store.ListClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := map[string]*Target{
+		"": r.Local(),
+	}
+	for _, c := range clusters {
+		client, err := r.clientFor(ctx, c)
+		if err != nil {
+			l.Error("Failed to build cluster client", zap.String("cluster", c.ID), zap.Error(err))
+			continue
+		}
+		targets[c.ID] = targetFor(c, client)
+	}
+	return targets, nil
+}
+
+// Target returns the target for a single cluster id
+func (r *Registry) Target(ctx context.Context, clusterID string) (*Target, error) {
+	if clusterID == "" {
+		return r.Local(), nil
+	}
+	c, err := r.store.GetClusterByID(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := r.clientFor(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return targetFor(c, client), nil
+}
+
+func targetFor(c store.Cluster, client cachedClient) *Target {
+	return &Target{
+		ID:               c.ID,
+		Server:           c.Server,
+		KubeconfigSecret: c.KubeconfigSecret,
+		Config:           client.config,
+		Client:           client.client,
+	}
+}
+
+// clientFor returns a client for the cluster, rebuilding it when its secret changes
+func (r *Registry) clientFor(ctx context.Context, c store.Cluster) (cachedClient, error) {
+	if c.Server == constants.InClusterServer {
+		return cachedClient{config: r.localConfig, client: r.local}, nil
+	}
+	if c.KubeconfigSecret == "" {
+		return cachedClient{}, fmt.Errorf("cluster %s has no kubeconfig secret", c.ID)
+	}
+
+	secret, err := r.local.CoreV1().Secrets(constants.OpenshiftGitopsNamespace).Get(ctx, c.KubeconfigSecret, metav1.GetOptions{})
+	if err != nil {
+		return cachedClient{}, fmt.Errorf("failed to get kubeconfig secret: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cached, ok := r.clients[c.ID]; ok && cached.resourceVersion == secret.ResourceVersion {
+		return cached, nil
+	}
+
+	config, client, err := clientFromSecret(secret)
+	if err != nil {
+		return cachedClient{}, err
+	}
+	cached := cachedClient{
+		resourceVersion: secret.ResourceVersion,
+		config:          config,
+		client:          client,
+	}
+	r.clients[c.ID] = cached
+	return cached, nil
+}
+
+// clientFromSecret builds a client from the kubeconfig stored in a secret
+func clientFromSecret(secret *corev1.Secret) (*rest.Config, kubernetes.Interface, error) {
+	kubeconfig, ok := secret.Data[constants.KubeconfigSecretKey]
+	if !ok {
+		return nil, nil, fmt.Errorf("secret %s has no %s key", secret.Name, constants.KubeconfigSecretKey)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+	tracing.WrapConfig(config)
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, client, nil
+}
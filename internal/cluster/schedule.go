@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"errors"
+	v1 "poc-cloud-service/gen/api/v1"
+)
+
+var (
+	ErrClusterNotFound = errors.New("cluster not found")
+	ErrClusterFull     = errors.New("cluster is at capacity")
+	ErrNoCluster       = errors.New("no cluster matches the placement")
+)
+
+// Schedule picks the cluster a new tenant is placed on.
+// An explicit cluster id wins, otherwise the least loaded cluster matching the
+// selector is picked. Without any registered cluster, tenants go to the local cluster.
+// The tenant counts may be stale by the time the tenant is stored, the capacity is checked again then with the cluster locked.
+func Schedule(clusters []*v1.Cluster, placement *v1.Placement) (string, error) {
+	if id := placement.GetClusterId(); id != "" {
+		for _, c := range clusters {
+			if c.GetId() != id {
+				continue
+			}
+			if !hasCapacity(c) {
+				return "", ErrClusterFull
+			}
+			return id, nil
+		}
+		return "", ErrClusterNotFound
+	}
+
+	if len(clusters) == 0 && len(placement.GetClusterSelector()) == 0 {
+		return "", nil
+	}
+
+	var best *v1.Cluster
+	for _, c := range clusters {
+		if !matches(c.GetLabels(), placement.GetClusterSelector()) || !hasCapacity(c) {
+			continue
+		}
+		if best == nil || c.GetTenantCount() < best.GetTenantCount() {
+			best = c
+		}
+	}
+	if best == nil {
+		return "", ErrNoCluster
+	}
+	return best.GetId(), nil
+}
+
+func hasCapacity(c *v1.Cluster) bool {
+	return c.GetCapacity() == 0 || c.GetTenantCount() < c.GetCapacity()
+}
+
+func matches(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,7 @@ package constants
 import (
 	"fmt"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	v1 "poc-cloud-service/gen/api/v1"
 )
 
 var ArgoApplicationsGVR = schema.GroupVersionResource{
@@ -17,8 +18,55 @@ var ArgoApplicationGVK = schema.GroupVersionKind{
 	Kind:    "Application",
 }
 
+var FluxGitRepositoriesGVR = schema.GroupVersionResource{
+	Group:    "source.toolkit.fluxcd.io",
+	Version:  "v1",
+	Resource: "gitrepositories",
+}
+
+var FluxGitRepositoryGVK = schema.GroupVersionKind{
+	Group:   "source.toolkit.fluxcd.io",
+	Version: "v1",
+	Kind:    "GitRepository",
+}
+
+var FluxHelmRepositoriesGVR = schema.GroupVersionResource{
+	Group:    "source.toolkit.fluxcd.io",
+	Version:  "v1",
+	Resource: "helmrepositories",
+}
+
+var FluxHelmRepositoryGVK = schema.GroupVersionKind{
+	Group:   "source.toolkit.fluxcd.io",
+	Version: "v1",
+	Kind:    "HelmRepository",
+}
+
+var FluxHelmReleasesGVR = schema.GroupVersionResource{
+	Group:    "helm.toolkit.fluxcd.io",
+	Version:  "v2",
+	Resource: "helmreleases",
+}
+
+var FluxHelmReleaseGVK = schema.GroupVersionKind{
+	Group:   "helm.toolkit.fluxcd.io",
+	Version: "v2",
+	Kind:    "HelmRelease",
+}
+
 const TenantNamespacePrefix = "acs-"
 
+const (
+	IsTenantLabel = "is-tenant"
+	TenantLabel   = "tenant"
+)
+
+// Default source of tenants that do not set one
+const (
+	DefaultRepoURL  = "https://github.com/ludydoo/poc-cloud-service-manifests"
+	DefaultRepoPath = "tenant-manifests"
+)
+
 func NamespaceNameForTenant(tenantID string) string {
 	return fmt.Sprintf("%s%s", TenantNamespacePrefix, tenantID)
 }
@@ -27,5 +75,51 @@ func ApplicationNameForTenant(tenantID string) string {
 	return fmt.Sprintf("%s%s", TenantNamespacePrefix, tenantID)
 }
 
+// MoveApplicationNameForTenant is the name of the application deploying a tenant
+// to its target cluster while it is being moved
+func MoveApplicationNameForTenant(tenantID string) string {
+	return fmt.Sprintf("%s%s-move", TenantNamespacePrefix, tenantID)
+}
+
+// SecretValuesNameForDeployment is the name of the Secret holding the secret values of a deployment
+func SecretValuesNameForDeployment(name string) string {
+	return fmt.Sprintf("%s-secret-values", name)
+}
+
+// SecretValuesKey is the key of the values in secret values Secrets
+const SecretValuesKey = "values.yaml"
+
 const OpenshiftGitopsNamespace = "openshift-gitops"
 
+const FluxNamespace = "flux-system"
+
+// InClusterServer is the API server address of the cluster the service runs in
+const InClusterServer = "https://kubernetes.default.svc"
+
+// KubeconfigSecretKey is the key holding the kubeconfig in a cluster secret
+const KubeconfigSecretKey = "kubeconfig"
+
+const OperationTypeMove = "move"
+
+// ActiveOperationStates are the states of operations still in progress
+var ActiveOperationStates = []string{
+	v1.OperationState_OPERATION_STATE_PROVISIONING.String(),
+	v1.OperationState_OPERATION_STATE_WAITING.String(),
+	v1.OperationState_OPERATION_STATE_CLEANING_UP.String(),
+	v1.OperationState_OPERATION_STATE_ROLLING_BACK.String(),
+}
+
+
+// AppliedSpecAnnotation holds a digest of the spec the service last wrote to an object,
+// an object whose spec no longer matches it was changed out of band
+const AppliedSpecAnnotation = "poc-cloud-service/applied-spec"
+
+// ManagedAnnotation marks tenant namespaces managed by the service, namespaces without it are never deleted
+// until they are adopted by a tenant, see ImportTenant
+const ManagedAnnotation = "poc-cloud-service/managed"
+
+// ProtectedAnnotation set to "true" on a tenant namespace keeps the reconciler from deleting it
+const ProtectedAnnotation = "poc-cloud-service/protected"
+
+// OrphanedAtAnnotation records when the reconciler found a tenant namespace without tenant, its deletion grace period starts then
+const OrphanedAtAnnotation = "poc-cloud-service/orphaned-at"
@@ -3,7 +3,10 @@ package convert
 import (
 	"encoding/json"
 	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"poc-cloud-service/gen/api/v1"
 	"poc-cloud-service/internal/store"
 )
@@ -22,20 +25,110 @@ func TenantFromStore(tenant store.Tenant) (*v1.Tenant, error) {
 	if helmValues.GetStructValue() == nil {
 		return nil, fmt.Errorf("bad helm value format")
 	}
+	var valueFiles []string
+	if len(tenant.ValueFiles) > 0 {
+		if err := json.Unmarshal(tenant.ValueFiles, &valueFiles); err != nil {
+			return nil, err
+		}
+	}
+	parameters, err := unmarshalMessages(tenant.Parameters, func() *v1.HelmParameter { return &v1.HelmParameter{} })
+	if err != nil {
+		return nil, err
+	}
+	fileParameters, err := unmarshalMessages(tenant.FileParameters, func() *v1.HelmFileParameter { return &v1.HelmFileParameter{} })
+	if err != nil {
+		return nil, err
+	}
+	sources, err := unmarshalMessages(tenant.Sources, func() *v1.Source { return &v1.Source{} })
+	if err != nil {
+		return nil, err
+	}
+	kustomize, err := unmarshalMessage(tenant.Kustomize, func() *v1.Kustomize { return &v1.Kustomize{} })
+	if err != nil {
+		return nil, err
+	}
+	directory, err := unmarshalMessage(tenant.Directory, func() *v1.Directory { return &v1.Directory{} })
+	if err != nil {
+		return nil, err
+	}
 	source := &v1.Source{
 		RepoUrl:        tenant.RepoUrl,
 		Path:           tenant.Path,
 		TargetRevision: tenant.TargetRevision,
 		Helm: &v1.Helm{
-			Values: helmValues.GetStructValue(),
+			Values:         helmValues.GetStructValue(),
+			ValueFiles:     valueFiles,
+			Parameters:     parameters,
+			FileParameters: fileParameters,
 		},
+		Ref:       tenant.Ref,
+		Type:      v1.SourceType(v1.SourceType_value[tenant.SourceType]),
+		Kustomize: kustomize,
+		Directory: directory,
+	}
+	if tenant.ChartName != "" {
+		source.Kind = &v1.Source_Chart{Chart: &v1.ChartSource{
+			RepoUrl: tenant.ChartRepoUrl,
+			Name:    tenant.ChartName,
+			Version: tenant.ChartVersion,
+		}}
+	}
+	syncPolicy, err := syncPolicyFromStore(tenant.SyncPolicy)
+	if err != nil {
+		return nil, err
+	}
+	lastDrift, err := unmarshalMessage(tenant.LastDrift, func() *v1.TenantEvent { return &v1.TenantEvent{} })
+	if err != nil {
+		return nil, err
+	}
+	conditions, err := ConditionsFromStore(tenant.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	clusterSelector := map[string]string{}
+	if len(tenant.ClusterSelector) > 0 {
+		if err := json.Unmarshal(tenant.ClusterSelector, &clusterSelector); err != nil {
+			return nil, err
+		}
 	}
 	return &v1.Tenant{
 		Id:     tenant.ID,
 		Source: source,
+		Placement: &v1.Placement{
+			ClusterSelector: clusterSelector,
+		},
+		ClusterId:  tenant.ClusterID,
+		Sources:    sources,
+		PlanId:     tenant.PlanID,
+		Suspended:  tenant.Suspended,
+		SyncPolicy: syncPolicy,
+		DriftCount: tenant.DriftCount,
+		LastDrift:  lastDrift,
+		Conditions: conditions,
 	}, nil
 }
 
+// ConditionsFromStore reads the conditions of a tenant, stored as a list of metav1.Condition
+func ConditionsFromStore(data []byte) ([]*v1.Condition, error) {
+	var stored []metav1.Condition
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, err
+		}
+	}
+	conditions := make([]*v1.Condition, len(stored))
+	for i, c := range stored {
+		conditions[i] = &v1.Condition{
+			Type:               c.Type,
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: timestamppb.New(c.LastTransitionTime.Time),
+		}
+	}
+	return conditions, nil
+}
+
 func TenantsFromStore(tenants []store.Tenant) ([]*v1.Tenant, error) {
 	ret := make([]*v1.Tenant, len(tenants))
 	for i, tenant := range tenants {
@@ -47,3 +140,136 @@ func TenantsFromStore(tenants []store.Tenant) ([]*v1.Tenant, error) {
 	}
 	return ret, nil
 }
+
+func ClusterFromStore(cluster store.Cluster) (*v1.Cluster, error) {
+	labels := map[string]string{}
+	if len(cluster.Labels) > 0 {
+		if err := json.Unmarshal(cluster.Labels, &labels); err != nil {
+			return nil, err
+		}
+	}
+	return &v1.Cluster{
+		Id:               cluster.ID,
+		Name:             cluster.Name,
+		Server:           cluster.Server,
+		Region:           cluster.Region,
+		Labels:           labels,
+		Capacity:         cluster.Capacity,
+		KubeconfigSecret: cluster.KubeconfigSecret,
+	}, nil
+}
+
+func PlanFromStore(plan store.Plan) (*v1.Plan, error) {
+	ret := &v1.Plan{
+		Id:   plan.ID,
+		Name: plan.Name,
+	}
+	if len(plan.ValuesSchema) > 0 && string(plan.ValuesSchema) != "{}" {
+		ret.ValuesSchema = &structpb.Struct{}
+		if err := ret.ValuesSchema.UnmarshalJSON(plan.ValuesSchema); err != nil {
+			return nil, err
+		}
+	}
+	syncPolicy, err := syncPolicyFromStore(plan.SyncPolicy)
+	if err != nil {
+		return nil, err
+	}
+	ret.SyncPolicy = syncPolicy
+	return ret, nil
+}
+
+// SyncPolicyToStore stores a sync policy, an unset policy as NULL. An empty policy is kept, it disables automated sync.
+func SyncPolicyToStore(policy *v1.SyncPolicy) ([]byte, error) {
+	if policy == nil {
+		return nil, nil
+	}
+	return protojson.Marshal(policy)
+}
+
+// syncPolicyFromStore reads a sync policy written by SyncPolicyToStore, nil if it was unset
+func syncPolicyFromStore(data []byte) (*v1.SyncPolicy, error) {
+	if data == nil {
+		return nil, nil
+	}
+	policy := &v1.SyncPolicy{}
+	if err := protojson.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func PlansFromStore(plans []store.Plan) ([]*v1.Plan, error) {
+	ret := make([]*v1.Plan, len(plans))
+	for i, plan := range plans {
+		p, err := PlanFromStore(plan)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = p
+	}
+	return ret, nil
+}
+
+func TenantEventFromStore(event store.TenantEvent) (*v1.TenantEvent, error) {
+	fields, err := unmarshalMessages(event.Fields, func() *v1.FieldDiff { return &v1.FieldDiff{} })
+	if err != nil {
+		return nil, err
+	}
+	return &v1.TenantEvent{
+		Id:         event.ID,
+		TenantId:   event.TenantID,
+		Reason:     event.Reason,
+		Message:    event.Message,
+		ApiVersion: event.ApiVersion,
+		Kind:       event.Kind,
+		Namespace:  event.Namespace,
+		Name:       event.Name,
+		Fields:     fields,
+		CreateTime: timestamppb.New(event.CreatedAt.Time),
+	}, nil
+}
+
+func TenantEventsFromStore(events []store.TenantEvent) ([]*v1.TenantEvent, error) {
+	ret := make([]*v1.TenantEvent, len(events))
+	for i, event := range events {
+		e, err := TenantEventFromStore(event)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = e
+	}
+	return ret, nil
+}
+
+// FieldDiffsToStore stores the fields of a tenant event
+func FieldDiffsToStore(fields []*v1.FieldDiff) ([]byte, error) {
+	return marshalMessages(fields)
+}
+
+// LastDriftToStore stores the last drift event of a tenant
+func LastDriftToStore(event *v1.TenantEvent) ([]byte, error) {
+	return marshalMessage(event)
+}
+
+func OperationFromStore(operation store.Operation) *v1.Operation {
+	return &v1.Operation{
+		Id:              operation.ID,
+		TenantId:        operation.TenantID,
+		Type:            operation.Type,
+		State:           v1.OperationState(v1.OperationState_value[operation.State]),
+		SourceClusterId: operation.SourceClusterID,
+		TargetClusterId: operation.TargetClusterID,
+		Message:         operation.Message,
+		CreateTime:      timestamppb.New(operation.CreatedAt.Time),
+		UpdateTime:      timestamppb.New(operation.UpdatedAt.Time),
+		Deadline:        timestamppb.New(operation.Deadline.Time),
+	}
+}
+
+func OperationsFromStore(operations []store.Operation) []*v1.Operation {
+	ret := make([]*v1.Operation, len(operations))
+	for i, operation := range operations {
+		ret[i] = OperationFromStore(operation)
+	}
+	return ret
+}
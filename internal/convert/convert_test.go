@@ -0,0 +1,36 @@
+package convert
+
+import (
+	"google.golang.org/protobuf/proto"
+	"poc-cloud-service/gen/api/v1"
+	"testing"
+)
+
+func TestSyncPolicyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *v1.SyncPolicy
+	}{
+		{"unset", nil},
+		{"empty", &v1.SyncPolicy{}},
+		{"automated", &v1.SyncPolicy{Automated: true, Prune: true, SyncOptions: []string{"CreateNamespace=true"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := SyncPolicyToStore(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (tt.policy == nil) != (data == nil) {
+				t.Fatalf("an unset policy must be stored as NULL and only it, got %q", data)
+			}
+			got, err := syncPolicyFromStore(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.policy == nil) || !proto.Equal(got, tt.policy) {
+				t.Errorf("got %v, want %v", got, tt.policy)
+			}
+		})
+	}
+}
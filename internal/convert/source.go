@@ -0,0 +1,118 @@
+package convert
+
+import (
+	"encoding/json"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/store"
+)
+
+// SourceToStore returns the source columns of a tenant, the id is left empty
+func SourceToStore(source *v1.Source, sources []*v1.Source) (store.UpdateTenantParams, error) {
+	valuesJson, err := source.GetHelm().GetValues().MarshalJSON()
+	if err != nil {
+		return store.UpdateTenantParams{}, err
+	}
+	valueFiles := source.GetHelm().GetValueFiles()
+	if valueFiles == nil {
+		valueFiles = []string{}
+	}
+	valueFilesJson, err := json.Marshal(valueFiles)
+	if err != nil {
+		return store.UpdateTenantParams{}, err
+	}
+	parametersJson, err := marshalMessages(source.GetHelm().GetParameters())
+	if err != nil {
+		return store.UpdateTenantParams{}, err
+	}
+	fileParametersJson, err := marshalMessages(source.GetHelm().GetFileParameters())
+	if err != nil {
+		return store.UpdateTenantParams{}, err
+	}
+	sourcesJson, err := marshalMessages(sources)
+	if err != nil {
+		return store.UpdateTenantParams{}, err
+	}
+	kustomizeJson, err := marshalMessage(source.GetKustomize())
+	if err != nil {
+		return store.UpdateTenantParams{}, err
+	}
+	directoryJson, err := marshalMessage(source.GetDirectory())
+	if err != nil {
+		return store.UpdateTenantParams{}, err
+	}
+	return store.UpdateTenantParams{
+		RepoUrl:        source.GetRepoUrl(),
+		Path:           source.GetPath(),
+		TargetRevision: source.GetTargetRevision(),
+		Values:         valuesJson,
+		ChartRepoUrl:   source.GetChart().GetRepoUrl(),
+		ChartName:      source.GetChart().GetName(),
+		ChartVersion:   source.GetChart().GetVersion(),
+		ValueFiles:     valueFilesJson,
+		Parameters:     parametersJson,
+		FileParameters: fileParametersJson,
+		Ref:            source.GetRef(),
+		Sources:        sourcesJson,
+		SourceType:     source.GetType().String(),
+		Kustomize:      kustomizeJson,
+		Directory:      directoryJson,
+	}, nil
+}
+
+// marshalMessage stores an optional message as its protojson form, an unset message as an empty object
+func marshalMessage[T proto.Message](message T) ([]byte, error) {
+	if !message.ProtoReflect().IsValid() {
+		return []byte("{}"), nil
+	}
+	return protojson.Marshal(message)
+}
+
+// unmarshalMessage reads a message written by marshalMessage, nil if it was unset
+func unmarshalMessage[T proto.Message](data []byte, newMessage func() T) (T, error) {
+	var unset T
+	if len(data) == 0 || string(data) == "{}" {
+		return unset, nil
+	}
+	message := newMessage()
+	if err := protojson.Unmarshal(data, message); err != nil {
+		return unset, err
+	}
+	return message, nil
+}
+
+// marshalMessages stores a list of messages as a json array of their protojson form
+func marshalMessages[T proto.Message](messages []T) ([]byte, error) {
+	raw := make([]json.RawMessage, len(messages))
+	for i, message := range messages {
+		b, err := protojson.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = b
+	}
+	return json.Marshal(raw)
+}
+
+// unmarshalMessages reads a list of messages written by marshalMessages
+func unmarshalMessages[T proto.Message](data []byte, newMessage func() T) ([]T, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	messages := make([]T, len(raw))
+	for i, b := range raw {
+		messages[i] = newMessage()
+		if err := protojson.Unmarshal(b, messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
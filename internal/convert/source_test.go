@@ -0,0 +1,123 @@
+package convert
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/store"
+	"testing"
+)
+
+func TestSourceRoundTrip(t *testing.T) {
+	values, err := structpb.NewStruct(map[string]interface{}{
+		"replicas": 2.0,
+		"image":    map[string]interface{}{"tag": "v1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		source  *v1.Source
+		sources []*v1.Source
+	}{
+		{
+			name: "git helm source",
+			source: &v1.Source{
+				RepoUrl:        "https://github.com/org/repo",
+				Path:           "chart",
+				TargetRevision: "v1.2.3",
+				Type:           v1.SourceType_SOURCE_TYPE_HELM,
+				Helm: &v1.Helm{
+					Values:         values,
+					ValueFiles:     []string{"values-prod.yaml", "$config/tenant.yaml"},
+					Parameters:     []*v1.HelmParameter{{Name: "image.tag", Value: "v2", ForceString: true}},
+					FileParameters: []*v1.HelmFileParameter{{Name: "config", Path: "files/config.json"}},
+				},
+			},
+			sources: []*v1.Source{
+				{RepoUrl: "https://github.com/org/config", Ref: "config", Helm: &v1.Helm{ValueFiles: []string{"other.yaml"}}},
+			},
+		},
+		{
+			name: "chart source",
+			source: &v1.Source{
+				Type: v1.SourceType_SOURCE_TYPE_HELM,
+				Helm: &v1.Helm{Values: &structpb.Struct{}},
+				Kind: &v1.Source_Chart{Chart: &v1.ChartSource{
+					RepoUrl: "oci://registry.example.com/charts",
+					Name:    "app",
+					Version: "~1.0",
+				}},
+			},
+		},
+		{
+			name: "kustomize source",
+			source: &v1.Source{
+				RepoUrl: "https://github.com/org/repo",
+				Path:    "overlays/prod",
+				Type:    v1.SourceType_SOURCE_TYPE_KUSTOMIZE,
+				Helm:    &v1.Helm{Values: &structpb.Struct{}},
+				Kustomize: &v1.Kustomize{
+					Images:       []string{"app=registry.example.com/app:v2"},
+					NamePrefix:   "prod-",
+					CommonLabels: map[string]string{"env": "prod"},
+					Patches: []*v1.KustomizePatch{{
+						Path:   "patches/replicas.yaml",
+						Target: &v1.KustomizePatchTarget{Kind: "Deployment", Name: "app"},
+					}},
+				},
+			},
+		},
+		{
+			name: "directory source",
+			source: &v1.Source{
+				RepoUrl:   "https://github.com/org/repo",
+				Path:      "manifests",
+				Type:      v1.SourceType_SOURCE_TYPE_DIRECTORY,
+				Helm:      &v1.Helm{Values: &structpb.Struct{}},
+				Directory: &v1.Directory{Recurse: true, Include: "*.yaml"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := SourceToStore(tt.source, tt.sources)
+			if err != nil {
+				t.Fatalf("to store: %v", err)
+			}
+			tenant, err := TenantFromStore(store.Tenant{
+				ID:             "t1",
+				RepoUrl:        params.RepoUrl,
+				Path:           params.Path,
+				TargetRevision: params.TargetRevision,
+				Values:         params.Values,
+				ChartRepoUrl:   params.ChartRepoUrl,
+				ChartName:      params.ChartName,
+				ChartVersion:   params.ChartVersion,
+				ValueFiles:     params.ValueFiles,
+				Parameters:     params.Parameters,
+				FileParameters: params.FileParameters,
+				Ref:            params.Ref,
+				Sources:        params.Sources,
+				SourceType:     params.SourceType,
+				Kustomize:      params.Kustomize,
+				Directory:      params.Directory,
+			})
+			if err != nil {
+				t.Fatalf("from store: %v", err)
+			}
+			if !proto.Equal(tenant.GetSource(), tt.source) {
+				t.Errorf("source = %v, want %v", tenant.GetSource(), tt.source)
+			}
+			if len(tenant.GetSources()) != len(tt.sources) {
+				t.Fatalf("got %d sources, want %d", len(tenant.GetSources()), len(tt.sources))
+			}
+			for i, source := range tt.sources {
+				if !proto.Equal(tenant.GetSources()[i], source) {
+					t.Errorf("sources[%d] = %v, want %v", i, tenant.GetSources()[i], source)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,768 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/argocd"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+const (
+	argoCdManagedBy          = "argocd.argoproj.io/managed-by"
+	managedByOpenshiftGitops = "openshift-gitops"
+	ociScheme                = "oci://"
+	// latestChartVersion is the semver constraint matching any chart version
+	latestChartVersion    = "*"
+	argoRefreshAnnotation = "argocd.argoproj.io/refresh"
+	// argoOperator is the user operations started through the API are recorded as initiated by
+	argoOperator = "poc-cloud-service"
+	// secretValuesSecretParameter is the chart value holding the name of the secret values Secret
+	secretValuesSecretParameter = "secretValuesSecret"
+)
+
+// ArgoCD deploys tenants as Argo CD Applications
+type ArgoCD struct {
+	dynamicClient dynamic.Interface
+	informer      informers.GenericInformer
+}
+
+func NewArgoCD(ctx context.Context, dynamicClient dynamic.Interface) *ArgoCD {
+	return &ArgoCD{
+		dynamicClient: dynamicClient,
+		informer:      startInformer(ctx, dynamicClient, constants.OpenshiftGitopsNamespace, constants.ArgoApplicationsGVR),
+	}
+}
+
+// HasSynced tells whether the informer cache is synced
+func (a *ArgoCD) HasSynced() bool {
+	return a.informer.Informer().HasSynced()
+}
+
+// Ensure writes the secret values next to the workloads, where the chart reads them, then the application
+func (a *ArgoCD) Ensure(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) error {
+	if err := ensureSecretValues(ctx, target.Client, constants.NamespaceNameForTenant(tenant.GetId()), argoSecretValuesName(tenant), tenant); err != nil {
+		return err
+	}
+	want, err := makeTenantApplication(tenant, target.Server)
+	if err != nil {
+		return err
+	}
+	want.SetName(name)
+	return ensureObject(ctx, a.applications(), want)
+}
+
+// Preview compares the secret values Secret and the application with the live ones
+func (a *ArgoCD) Preview(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) ([]Change, error) {
+	want, err := makeTenantApplication(tenant, target.Server)
+	if err != nil {
+		return nil, err
+	}
+	want.SetName(name)
+	changes, err := previewSecretValues(ctx, nil, target.Client, constants.NamespaceNameForTenant(tenant.GetId()), argoSecretValuesName(tenant), tenant)
+	if err != nil {
+		return nil, err
+	}
+	return previewObject(ctx, changes, a.applications(), name, want)
+}
+
+// PreviewDelete only covers the application, its resources are deleted with the tenant namespace
+func (a *ArgoCD) PreviewDelete(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) ([]Change, error) {
+	return previewObject(ctx, nil, a.applications(), name, nil)
+}
+
+func (a *ArgoCD) Delete(ctx context.Context, name string) error {
+	return deleteObject(ctx, a.applications(), name)
+}
+
+// Release deletes the application, tenant applications have no resources finalizer so nothing is pruned
+func (a *ArgoCD) Release(ctx context.Context, name string) error {
+	return deleteObject(ctx, a.applications(), name)
+}
+
+func (a *ArgoCD) Observe(ctx context.Context, name string) (*v1.Application, error) {
+	obj, err := getCached(a.informer, constants.OpenshiftGitopsNamespace, name)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	app, err := argocd.FromUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return applicationFromArgo(app), nil
+}
+
+// Resources returns the resources listed in the application status, hooks left out
+func (a *ArgoCD) Resources(ctx context.Context, name string) ([]*v1.TenantResource, error) {
+	obj, err := getCached(a.informer, constants.OpenshiftGitopsNamespace, name)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	app, err := argocd.FromUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]*v1.TenantResource, 0, len(app.Status.Resources))
+	for _, r := range app.Status.Resources {
+		if r.Hook {
+			continue
+		}
+		resource := &v1.TenantResource{
+			Group:           r.Group,
+			Version:         r.Version,
+			Kind:            r.Kind,
+			Namespace:       r.Namespace,
+			Name:            r.Name,
+			SyncStatus:      r.Status,
+			RequiresPruning: r.RequiresPruning,
+		}
+		if r.Health != nil {
+			resource.Health = &v1.Health{Status: r.Health.Status, Message: r.Health.Message}
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// Sync sets the operation of the application, the application controller runs it and clears it
+func (a *ArgoCD) Sync(ctx context.Context, name string, options SyncOptions) (*v1.Application, error) {
+	obj, err := a.getApplication(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	app, err := argocd.FromUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Object["operation"] != nil || isRunning(app) {
+		return nil, ErrOperationInProgress
+	}
+
+	sync := map[string]interface{}{
+		"prune":  options.Prune,
+		"dryRun": options.DryRun,
+	}
+	if options.Force {
+		sync["syncStrategy"] = map[string]interface{}{
+			"hook": map[string]interface{}{"force": true},
+		}
+	}
+	if len(options.Resources) > 0 {
+		resources := make([]interface{}, 0, len(options.Resources))
+		for _, r := range options.Resources {
+			resources = append(resources, map[string]interface{}{
+				"group":     r.GetGroup(),
+				"kind":      r.GetKind(),
+				"namespace": r.GetNamespace(),
+				"name":      r.GetName(),
+			})
+		}
+		sync["resources"] = resources
+	}
+	return a.patchApplication(ctx, name, map[string]interface{}{
+		"operation": map[string]interface{}{
+			"initiatedBy": map[string]interface{}{"username": argoOperator},
+			"sync":        sync,
+		},
+	})
+}
+
+// Refresh sets the refresh annotation, which the application controller removes once refreshed
+func (a *ArgoCD) Refresh(ctx context.Context, name string, hard bool) (*v1.Application, error) {
+	if _, err := a.getApplication(ctx, name); err != nil {
+		return nil, err
+	}
+	refresh := "normal"
+	if hard {
+		refresh = "hard"
+	}
+	return a.patchApplication(ctx, name, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{argoRefreshAnnotation: refresh},
+		},
+	})
+}
+
+// TerminateOperation marks the running operation as terminating, like the Argo CD API server does
+func (a *ArgoCD) TerminateOperation(ctx context.Context, name string) (*v1.Application, error) {
+	obj, err := a.getApplication(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	app, err := argocd.FromUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	if !isRunning(app) {
+		return nil, ErrNoOperation
+	}
+	return a.patchApplication(ctx, name, map[string]interface{}{
+		"status": map[string]interface{}{
+			"operationState": map[string]interface{}{"phase": "Terminating"},
+		},
+	})
+}
+
+// Import reads the tenant deployed by an application, from its sources and sync policy
+func (a *ArgoCD) Import(ctx context.Context, name string) (*v1.Tenant, error) {
+	obj, err := a.getApplication(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	app, err := argocd.FromUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	tenant := &v1.Tenant{SyncPolicy: syncPolicyFromArgo(app.Spec.SyncPolicy)}
+	switch {
+	case app.Spec.Source != nil:
+		if tenant.Source, err = sourceFromArgo(*app.Spec.Source); err != nil {
+			return nil, err
+		}
+	case len(app.Spec.Sources) > 0:
+		// The first source is the tenant source, as written by makeTenantApplication
+		for i, s := range app.Spec.Sources {
+			source, err := sourceFromArgo(s)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				tenant.Source = source
+			} else {
+				tenant.Sources = append(tenant.Sources, source)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("application %s has no source", name)
+	}
+	return tenant, nil
+}
+
+// sourceFromArgo reads a tenant source from an Argo CD source, the reverse of makeSource and setSourceOptions
+func sourceFromArgo(s argocd.ApplicationSource) (*v1.Source, error) {
+	source := &v1.Source{
+		RepoUrl:        s.RepoURL,
+		Path:           s.Path,
+		TargetRevision: s.TargetRevision,
+		Ref:            s.Ref,
+	}
+	if s.Chart != "" {
+		repoURL := s.RepoURL
+		if !strings.Contains(repoURL, "://") {
+			repoURL = ociScheme + repoURL
+		}
+		chart := &v1.ChartSource{RepoUrl: repoURL, Name: s.Chart}
+		if s.TargetRevision != latestChartVersion {
+			chart.Version = s.TargetRevision
+		}
+		source = &v1.Source{Kind: &v1.Source_Chart{Chart: chart}, Ref: s.Ref}
+	}
+	switch {
+	case s.Kustomize != nil:
+		source.Type = v1.SourceType_SOURCE_TYPE_KUSTOMIZE
+		source.Kustomize = &v1.Kustomize{
+			Images:       s.Kustomize.Images,
+			NamePrefix:   s.Kustomize.NamePrefix,
+			CommonLabels: s.Kustomize.CommonLabels,
+		}
+		for _, patch := range s.Kustomize.Patches {
+			p := &v1.KustomizePatch{Patch: patch.Patch, Path: patch.Path}
+			if t := patch.Target; t != nil {
+				p.Target = &v1.KustomizePatchTarget{
+					Group:         t.Group,
+					Version:       t.Version,
+					Kind:          t.Kind,
+					Name:          t.Name,
+					Namespace:     t.Namespace,
+					LabelSelector: t.LabelSelector,
+				}
+			}
+			source.Kustomize.Patches = append(source.Kustomize.Patches, p)
+		}
+	case s.Directory != nil:
+		source.Type = v1.SourceType_SOURCE_TYPE_DIRECTORY
+		source.Directory = &v1.Directory{
+			Recurse: s.Directory.Recurse,
+			Include: s.Directory.Include,
+			Exclude: s.Directory.Exclude,
+		}
+	case s.Helm != nil:
+		helm, err := helmFromArgo(s.Helm)
+		if err != nil {
+			return nil, err
+		}
+		source.Helm = helm
+	}
+	return source, nil
+}
+
+// helmFromArgo reads the helm options of an Argo CD source, values set as an object are merged over the YAML ones
+func helmFromArgo(h *argocd.ApplicationSourceHelm) (*v1.Helm, error) {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(h.Values), &values); err != nil {
+		return nil, fmt.Errorf("failed to parse helm values: %w", err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	for k, v := range h.ValuesObject {
+		values[k] = v
+	}
+	valuesStruct, err := structpb.NewStruct(values)
+	if err != nil {
+		return nil, err
+	}
+	helm := &v1.Helm{
+		Values:     valuesStruct,
+		ValueFiles: h.ValueFiles,
+	}
+	for _, parameter := range h.Parameters {
+		helm.Parameters = append(helm.Parameters, &v1.HelmParameter{
+			Name:        parameter.Name,
+			Value:       parameter.Value,
+			ForceString: parameter.ForceString,
+		})
+	}
+	for _, parameter := range h.FileParameters {
+		helm.FileParameters = append(helm.FileParameters, &v1.HelmFileParameter{
+			Name: parameter.Name,
+			Path: parameter.Path,
+		})
+	}
+	return helm, nil
+}
+
+// syncPolicyFromArgo reads the sync policy of an application, the reverse of makeSyncPolicy
+func syncPolicyFromArgo(p *argocd.SyncPolicy) *v1.SyncPolicy {
+	policy := &v1.SyncPolicy{}
+	if p == nil {
+		return policy
+	}
+	if automated := p.Automated; automated != nil {
+		policy.Automated = true
+		policy.Prune = automated.Prune
+		policy.SelfHeal = automated.SelfHeal
+		policy.AllowEmpty = automated.AllowEmpty
+	}
+	policy.SyncOptions = p.SyncOptions
+	if retry := p.Retry; retry != nil {
+		policy.Retry = &v1.SyncRetry{Limit: retry.Limit}
+		if backoff := retry.Backoff; backoff != nil {
+			policy.Retry.BackoffDuration = backoff.Duration
+			policy.Retry.BackoffMaxDuration = backoff.MaxDuration
+			if backoff.Factor != nil {
+				policy.Retry.BackoffFactor = *backoff.Factor
+			}
+		}
+	}
+	return policy
+}
+
+// getApplication reads an application from the API server, the informer cache may miss a recent operation
+func (a *ArgoCD) getApplication(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	obj, err := a.applications().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (a *ArgoCD) patchApplication(ctx context.Context, name string, patch map[string]interface{}) (*v1.Application, error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := a.applications().Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	app, err := argocd.FromUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return applicationFromArgo(app), nil
+}
+
+func isRunning(app *argocd.Application) bool {
+	op := app.Status.OperationState
+	return op != nil && (op.Phase == "Running" || op.Phase == "Terminating")
+}
+
+// applicationFromArgo maps the status of an Argo CD Application
+func applicationFromArgo(app *argocd.Application) *v1.Application {
+	status := app.Status
+	ret := &v1.Application{
+		Health: &v1.Health{
+			Status:  status.Health.Status,
+			Message: status.Health.Message,
+		},
+		Sync: &v1.SyncStatus{
+			Status:    status.Sync.Status,
+			Revision:  status.Sync.Revision,
+			Revisions: status.Sync.Revisions,
+		},
+		Images:        status.Summary.Images,
+		ExternalUrls:  status.Summary.ExternalURLs,
+		ReconcileTime: timestamp(status.ReconciledAt),
+	}
+	if op := status.OperationState; op != nil {
+		ret.Operation = &v1.OperationStatus{
+			Phase:      op.Phase,
+			Message:    op.Message,
+			StartTime:  timestamp(&op.StartedAt),
+			FinishTime: timestamp(op.FinishedAt),
+			RetryCount: op.RetryCount,
+		}
+		if result := op.SyncResult; result != nil {
+			ret.Operation.Revision = result.Revision
+			ret.Operation.Revisions = result.Revisions
+			for _, r := range result.Resources {
+				ret.Operation.Resources = append(ret.Operation.Resources, &v1.ResourceResult{
+					Group:     r.Group,
+					Version:   r.Version,
+					Kind:      r.Kind,
+					Namespace: r.Namespace,
+					Name:      r.Name,
+					Status:    r.Status,
+					Message:   r.Message,
+					HookPhase: r.HookPhase,
+					SyncPhase: r.SyncPhase,
+				})
+			}
+		}
+	}
+	for _, c := range status.Conditions {
+		ret.Conditions = append(ret.Conditions, &v1.ApplicationCondition{
+			Type:               c.Type,
+			Message:            c.Message,
+			LastTransitionTime: timestamp(c.LastTransitionTime),
+		})
+	}
+	for _, h := range status.History {
+		ret.History = append(ret.History, &v1.DeploymentHistory{
+			Id:              h.ID,
+			Revision:        h.Revision,
+			Revisions:       h.Revisions,
+			DeployTime:      timestamp(&h.DeployedAt),
+			DeployStartTime: timestamp(h.DeployStartedAt),
+		})
+	}
+	return ret
+}
+
+// timestamp converts an optional Kubernetes time, nil and zero times are unset
+func timestamp(t *metav1.Time) *timestamppb.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t.Time)
+}
+
+func (a *ArgoCD) NamespaceLabels() map[string]string {
+	return map[string]string{
+		argoCdManagedBy: managedByOpenshiftGitops,
+	}
+}
+
+func (a *ArgoCD) applications() dynamic.ResourceInterface {
+	return a.dynamicClient.Resource(constants.ArgoApplicationsGVR).Namespace(constants.OpenshiftGitopsNamespace)
+}
+
+// argoSecretValuesName is shared by the tenant and move applications, which deploy to different clusters
+func argoSecretValuesName(tenant *v1.Tenant) string {
+	return constants.SecretValuesNameForDeployment(constants.ApplicationNameForTenant(tenant.GetId()))
+}
+
+// makeSource returns the location of an Argo CD source, a chart or a Git repository path
+func makeSource(s *v1.Source) map[string]interface{} {
+	if chart := s.GetChart(); chart != nil {
+		// Argo CD expects OCI registries without their scheme, declared in a repository secret with enableOCI
+		source := map[string]interface{}{
+			"repoURL":        strings.TrimPrefix(chart.GetRepoUrl(), ociScheme),
+			"chart":          chart.GetName(),
+			"targetRevision": latestChartVersion,
+		}
+		if version := chart.GetVersion(); len(version) > 0 {
+			source["targetRevision"] = version
+		}
+		return source
+	}
+
+	source := map[string]interface{}{
+		"repoURL": constants.DefaultRepoURL,
+		"path":    constants.DefaultRepoPath,
+	}
+	if repoURL := s.GetRepoUrl(); len(repoURL) > 0 {
+		source["repoURL"] = repoURL
+	}
+	if path := s.GetPath(); len(path) > 0 {
+		source["path"] = path
+	}
+	if targetRevision := s.GetTargetRevision(); len(targetRevision) > 0 {
+		source["targetRevision"] = targetRevision
+	}
+	if ref := s.GetRef(); len(ref) > 0 {
+		source["ref"] = ref
+	}
+	return source
+}
+
+// setSourceOptions sets the helm, kustomize or directory block of an Argo CD source from its type.
+// Helm sources without a release name only get a helm block when they configure helm.
+func setSourceOptions(source map[string]interface{}, s *v1.Source, releaseName string) error {
+	switch s.GetType() {
+	case v1.SourceType_SOURCE_TYPE_KUSTOMIZE:
+		source["kustomize"] = makeKustomize(s.GetKustomize())
+	case v1.SourceType_SOURCE_TYPE_DIRECTORY:
+		source["directory"] = makeDirectory(s.GetDirectory())
+	default:
+		if releaseName == "" && s.GetHelm() == nil {
+			return nil
+		}
+		helm, err := makeHelm(s.GetHelm())
+		if err != nil {
+			return err
+		}
+		if releaseName != "" {
+			helm["releaseName"] = releaseName
+		}
+		source["helm"] = helm
+	}
+	return nil
+}
+
+// makeKustomize returns the kustomize options of an Argo CD source
+func makeKustomize(k *v1.Kustomize) map[string]interface{} {
+	kustomize := map[string]interface{}{}
+	if len(k.GetImages()) > 0 {
+		images := make([]interface{}, len(k.GetImages()))
+		for i, image := range k.GetImages() {
+			images[i] = image
+		}
+		kustomize["images"] = images
+	}
+	if namePrefix := k.GetNamePrefix(); len(namePrefix) > 0 {
+		kustomize["namePrefix"] = namePrefix
+	}
+	if len(k.GetCommonLabels()) > 0 {
+		commonLabels := map[string]interface{}{}
+		for key, value := range k.GetCommonLabels() {
+			commonLabels[key] = value
+		}
+		kustomize["commonLabels"] = commonLabels
+	}
+	if len(k.GetPatches()) > 0 {
+		patches := make([]interface{}, len(k.GetPatches()))
+		for i, patch := range k.GetPatches() {
+			p := map[string]interface{}{}
+			if len(patch.GetPatch()) > 0 {
+				p["patch"] = patch.GetPatch()
+			}
+			if len(patch.GetPath()) > 0 {
+				p["path"] = patch.GetPath()
+			}
+			if t := patch.GetTarget(); t != nil {
+				target := map[string]interface{}{}
+				for key, value := range map[string]string{
+					"group":         t.GetGroup(),
+					"version":       t.GetVersion(),
+					"kind":          t.GetKind(),
+					"name":          t.GetName(),
+					"namespace":     t.GetNamespace(),
+					"labelSelector": t.GetLabelSelector(),
+				} {
+					if len(value) > 0 {
+						target[key] = value
+					}
+				}
+				p["target"] = target
+			}
+			patches[i] = p
+		}
+		kustomize["patches"] = patches
+	}
+	return kustomize
+}
+
+// makeDirectory returns the directory options of an Argo CD source
+func makeDirectory(d *v1.Directory) map[string]interface{} {
+	directory := map[string]interface{}{}
+	if d.GetRecurse() {
+		directory["recurse"] = true
+	}
+	if include := d.GetInclude(); len(include) > 0 {
+		directory["include"] = include
+	}
+	if exclude := d.GetExclude(); len(exclude) > 0 {
+		directory["exclude"] = exclude
+	}
+	return directory
+}
+
+// makeHelm returns the helm options of an Argo CD source, without the release name
+func makeHelm(h *v1.Helm) (map[string]interface{}, error) {
+	helm := map[string]interface{}{}
+	if values := h.GetValues().AsMap(); len(values) > 0 {
+		yamlBytes, err := yaml.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		helm["values"] = string(yamlBytes)
+	}
+	if len(h.GetValueFiles()) > 0 {
+		valueFiles := make([]interface{}, len(h.GetValueFiles()))
+		for i, valueFile := range h.GetValueFiles() {
+			valueFiles[i] = valueFile
+		}
+		helm["valueFiles"] = valueFiles
+	}
+	if len(h.GetParameters()) > 0 {
+		parameters := make([]interface{}, len(h.GetParameters()))
+		for i, parameter := range h.GetParameters() {
+			p := map[string]interface{}{
+				"name":  parameter.GetName(),
+				"value": parameter.GetValue(),
+			}
+			if parameter.GetForceString() {
+				p["forceString"] = true
+			}
+			parameters[i] = p
+		}
+		helm["parameters"] = parameters
+	}
+	if len(h.GetFileParameters()) > 0 {
+		fileParameters := make([]interface{}, len(h.GetFileParameters()))
+		for i, parameter := range h.GetFileParameters() {
+			fileParameters[i] = map[string]interface{}{
+				"name": parameter.GetName(),
+				"path": parameter.GetPath(),
+			}
+		}
+		helm["fileParameters"] = fileParameters
+	}
+	return helm, nil
+}
+
+// defaultSyncPolicy is the sync policy of tenants that have none
+var defaultSyncPolicy = &v1.SyncPolicy{
+	Automated: true,
+	Prune:     true,
+	SelfHeal:  true,
+}
+
+// makeSyncPolicy makes the syncPolicy of the application of a tenant
+func makeSyncPolicy(tenant *v1.Tenant) map[string]interface{} {
+	policy := tenant.GetSyncPolicy()
+	if policy == nil {
+		policy = defaultSyncPolicy
+	}
+	syncPolicy := map[string]interface{}{}
+	// Suspended tenants keep their application, without automated sync
+	if policy.GetAutomated() && !tenant.GetSuspended() {
+		syncPolicy["automated"] = map[string]interface{}{
+			"prune":      policy.GetPrune(),
+			"selfHeal":   policy.GetSelfHeal(),
+			"allowEmpty": policy.GetAllowEmpty(),
+		}
+	}
+	if options := policy.GetSyncOptions(); len(options) > 0 {
+		syncOptions := make([]interface{}, len(options))
+		for i, option := range options {
+			syncOptions[i] = option
+		}
+		syncPolicy["syncOptions"] = syncOptions
+	}
+	if retry := policy.GetRetry(); retry != nil {
+		backoff := map[string]interface{}{}
+		if retry.GetBackoffDuration() != "" {
+			backoff["duration"] = retry.GetBackoffDuration()
+		}
+		if retry.GetBackoffFactor() != 0 {
+			backoff["factor"] = retry.GetBackoffFactor()
+		}
+		if retry.GetBackoffMaxDuration() != "" {
+			backoff["maxDuration"] = retry.GetBackoffMaxDuration()
+		}
+		syncPolicy["retry"] = map[string]interface{}{
+			"limit":   retry.GetLimit(),
+			"backoff": backoff,
+		}
+	}
+	return syncPolicy
+}
+
+// makeTenantApplication creates an ArgoCD Application object for a tenant deployed to server
+func makeTenantApplication(tenant *v1.Tenant, server string) (*unstructured.Unstructured, error) {
+	u := &unstructured.Unstructured{}
+	u.SetNamespace(constants.OpenshiftGitopsNamespace)
+	u.SetName(constants.ApplicationNameForTenant(tenant.GetId()))
+	u.SetLabels(map[string]string{
+		constants.IsTenantLabel: "true",
+		constants.TenantLabel:   tenant.GetId(),
+	})
+	u.SetGroupVersionKind(constants.ArgoApplicationGVK)
+
+	source := makeSource(tenant.GetSource())
+	if err := setSourceOptions(source, tenant.GetSource(), constants.NamespaceNameForTenant(tenant.GetId())); err != nil {
+		return nil, err
+	}
+	if helm, ok := source["helm"].(map[string]interface{}); ok && len(tenant.GetSource().GetHelm().GetSecretValues().GetFields()) > 0 {
+		// Argo CD cannot read values from a Secret, the chart gets the name of the Secret in the tenant namespace
+		// instead. The secret values themselves never appear in the application.
+		values := tenant.GetSource().GetHelm().GetValues().AsMap()
+		values[secretValuesSecretParameter] = argoSecretValuesName(tenant)
+		delete(helm, "values")
+		helm["valuesObject"] = values
+	}
+
+	spec := map[string]interface{}{
+		"project": "default",
+		"destination": map[string]interface{}{
+			"server":    server,
+			"namespace": constants.NamespaceNameForTenant(tenant.GetId()),
+		},
+	}
+	if syncPolicy := makeSyncPolicy(tenant); len(syncPolicy) > 0 {
+		spec["syncPolicy"] = syncPolicy
+	}
+
+	if len(tenant.GetSources()) == 0 {
+		spec["source"] = source
+	} else {
+		// The tenant source comes first, followed by the others in order
+		sources := []interface{}{source}
+		for _, s := range tenant.GetSources() {
+			extra := makeSource(s)
+			if len(s.GetRef()) > 0 && len(s.GetPath()) == 0 && s.GetChart() == nil {
+				// A source only holding value files has no path to deploy
+				delete(extra, "path")
+			}
+			if err := setSourceOptions(extra, s, ""); err != nil {
+				return nil, err
+			}
+			sources = append(sources, extra)
+		}
+		spec["sources"] = sources
+	}
+	u.Object["spec"] = spec
+
+	return u, nil
+}
@@ -0,0 +1,87 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/protobuf/types/known/structpb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMakeTenantApplicationSecretValues(t *testing.T) {
+	values, _ := structpb.NewStruct(map[string]interface{}{
+		"db": map[string]interface{}{"host": "db", "password": "changeme"},
+	})
+	secretValues, _ := structpb.NewStruct(map[string]interface{}{
+		"db": map[string]interface{}{"password": "hunter2"},
+	})
+	tenant := &v1.Tenant{
+		Id: "t1",
+		Source: &v1.Source{
+			RepoUrl: "https://github.com/org/repo",
+			Path:    "chart",
+			Helm:    &v1.Helm{Values: values, SecretValues: secretValues},
+		},
+	}
+	app, err := makeTenantApplication(tenant, constants.InClusterServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appJson, err := json.Marshal(app.Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(appJson), "hunter2") {
+		t.Errorf("application holds the secret values: %s", appJson)
+	}
+	helm, _, _ := unstructured.NestedMap(app.Object, "spec", "source", "helm")
+	if _, ok := helm["values"]; ok {
+		t.Errorf("values should be replaced by valuesObject")
+	}
+	want := map[string]interface{}{
+		"db":                        map[string]interface{}{"host": "db", "password": "changeme"},
+		secretValuesSecretParameter: "acs-t1-secret-values",
+	}
+	if !reflect.DeepEqual(helm["valuesObject"], want) {
+		t.Errorf("valuesObject = %v, want %v", helm["valuesObject"], want)
+	}
+
+	// The secret values are delivered in a Secret of the tenant namespace on the target
+	client := fake.NewSimpleClientset()
+	if err := ensureSecretValues(context.Background(), client, constants.NamespaceNameForTenant("t1"), argoSecretValuesName(tenant), tenant); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.CoreV1().Secrets("acs-t1").Get(context.Background(), "acs-t1-secret-values", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(secret.Data[constants.SecretValuesKey]), "hunter2") {
+		t.Errorf("secret values Secret = %s, want the secret values", secret.Data[constants.SecretValuesKey])
+	}
+}
+
+func TestMakeSyncPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        *v1.SyncPolicy
+		wantAutomated bool
+	}{
+		{"unset policy is the default", nil, true},
+		{"empty policy is manual", &v1.SyncPolicy{}, false},
+		{"automated", &v1.SyncPolicy{Automated: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syncPolicy := makeSyncPolicy(&v1.Tenant{SyncPolicy: tt.policy})
+			if _, automated := syncPolicy["automated"]; automated != tt.wantAutomated {
+				t.Errorf("automated = %v, want %v", automated, tt.wantAutomated)
+			}
+		})
+	}
+}
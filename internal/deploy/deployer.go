@@ -0,0 +1,230 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/charts"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/log"
+	"reflect"
+	"time"
+)
+
+// Backends selectable with New
+const (
+	BackendArgoCD = "argocd"
+	BackendFlux   = "flux"
+	BackendHelm   = "helm"
+)
+
+// Deployer deploys tenants through a GitOps engine
+type Deployer interface {
+	// Ensure creates or updates the deployment called name for a tenant on the target cluster
+	Ensure(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) error
+	// Delete deletes the deployment called name, waiting for it to be gone if it is already being deleted
+	Delete(ctx context.Context, name string) error
+	// Release deletes the deployment called name but leaves what it deployed in place,
+	// so that another deployment of the same tenant can take it over
+	Release(ctx context.Context, name string) error
+	// Observe returns the status of the deployment called name, nil if it does not exist
+	Observe(ctx context.Context, name string) (*v1.Application, error)
+	// Resources returns the resources of the deployment called name as tracked by the engine, nil if it does not track them
+	Resources(ctx context.Context, name string) ([]*v1.TenantResource, error)
+	// Sync starts a sync of the deployment called name
+	Sync(ctx context.Context, name string, options SyncOptions) (*v1.Application, error)
+	// Refresh compares the deployment called name with its source again, hard also invalidates the cached source
+	Refresh(ctx context.Context, name string, hard bool) (*v1.Application, error)
+	// TerminateOperation stops the running sync of the deployment called name
+	TerminateOperation(ctx context.Context, name string) (*v1.Application, error)
+	// NamespaceLabels are the labels tenant namespaces need to be managed by the engine
+	NamespaceLabels() map[string]string
+	// Preview returns the changes Ensure would make, without making them
+	Preview(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) ([]Change, error)
+	// PreviewDelete returns the changes Delete would make, without making them
+	PreviewDelete(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) ([]Change, error)
+	// Import reads the sources and sync policy of the existing deployment called name, to adopt it into a tenant
+	Import(ctx context.Context, name string) (*v1.Tenant, error)
+}
+
+// New returns the deployer for a backend, once its caches are synced
+func New(ctx context.Context, backend string, client kubernetes.Interface, dynamicClient dynamic.Interface, fetcher *charts.Fetcher, clusters *cluster.Registry) (Deployer, error) {
+	switch backend {
+	case BackendArgoCD:
+		return NewArgoCD(ctx, dynamicClient), nil
+	case BackendFlux:
+		return NewFlux(ctx, client, dynamicClient), nil
+	case BackendHelm:
+		return NewHelm(fetcher, clusters.Targets), nil
+	default:
+		return nil, fmt.Errorf("unknown gitops backend %q", backend)
+	}
+}
+
+// HasSynced tells whether the caches of a deployer are synced, deployers without caches always are
+func HasSynced(d Deployer) bool {
+	if s, ok := d.(interface{ HasSynced() bool }); ok {
+		return s.HasSynced()
+	}
+	return true
+}
+
+// startInformer starts an informer for a resource in a namespace and waits for its cache to sync
+func startInformer(ctx context.Context, dynamicClient dynamic.Interface, namespace string, gvr schema.GroupVersionResource) informers.GenericInformer {
+	l := log.FromContext(ctx)
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, time.Hour, namespace, nil)
+	informer := factory.ForResource(gvr)
+
+	l.Info("starting informer", zap.String("resource", gvr.Resource))
+	go func() {
+		informer.Informer().Run(ctx.Done())
+	}()
+
+	l.Info("waiting for cache sync", zap.String("resource", gvr.Resource))
+	factory.WaitForCacheSync(ctx.Done())
+
+	l.Info("cache sync done", zap.String("resource", gvr.Resource))
+	return informer
+}
+
+// getCached returns an object from an informer cache, nil if it does not exist
+func getCached(informer informers.GenericInformer, namespace, name string) (*unstructured.Unstructured, error) {
+	obj, err := informer.Lister().ByNamespace(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type: %T", obj)
+	}
+	return u, nil
+}
+
+// ensureObject creates the object or updates its spec. The spec written is recorded in an annotation,
+// so that out of band changes are reported as drift before being corrected.
+func ensureObject(ctx context.Context, resource dynamic.ResourceInterface, want *unstructured.Unstructured) error {
+	l := log.FromContext(ctx).With(zap.String("kind", want.GetKind()), zap.String("name", want.GetName()))
+	got, err := resource.Get(ctx, want.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get %s: %w", want.GetKind(), err)
+		}
+		l.Info("Creating object")
+		if _, err := setAppliedSpec(want); err != nil {
+			return err
+		}
+		created, err := resource.Create(ctx, want, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", want.GetKind(), err)
+		}
+		eventf(ctx, created, corev1.EventTypeNormal, ReasonCreated, "Created %s %s", created.GetKind(), created.GetName())
+		return updateAppliedSpec(ctx, resource, created)
+	}
+
+	gotSpec := got.Object["spec"]
+	wantSpec := want.Object["spec"]
+	if reflect.DeepEqual(gotSpec, wantSpec) {
+		// Objects written before their spec was recorded get the annotation
+		return updateAppliedSpec(ctx, resource, got)
+	}
+
+	drifted, correct, err := recordSpecDrift(ctx, got, wantSpec)
+	if err != nil {
+		return fmt.Errorf("failed to record drift of %s: %w", want.GetKind(), err)
+	}
+	if !correct {
+		l.Info("Leaving drifted object")
+		return nil
+	}
+
+	// update
+	if drifted {
+		l.Info("Correcting drifted object")
+	} else {
+		l.Info("Updating object")
+	}
+	got.Object["spec"] = wantSpec
+	if _, err := setAppliedSpec(got); err != nil {
+		return err
+	}
+	updated, err := resource.Update(ctx, got, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", want.GetKind(), err)
+	}
+	eventf(ctx, updated, corev1.EventTypeNormal, ReasonUpdated, "Updated the spec of %s %s", updated.GetKind(), updated.GetName())
+
+	return updateAppliedSpec(ctx, resource, updated)
+}
+
+// updateAppliedSpec records the spec of an object as written, which differs from the one sent when the cluster defaults fields
+func updateAppliedSpec(ctx context.Context, resource dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
+	changed, err := setAppliedSpec(obj)
+	if err != nil || !changed {
+		return err
+	}
+	if _, err := resource.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update %s: %w", obj.GetKind(), err)
+	}
+	return nil
+}
+
+// deleteObject deletes an object and waits for it to be gone if it is already being deleted
+func deleteObject(ctx context.Context, resource dynamic.ResourceInterface, name string) error {
+
+	l := log.FromContext(ctx).With(zap.String("name", name))
+
+	got, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			l.Info("Object already deleted")
+			return nil
+		}
+		return err
+	}
+
+	if got.GetDeletionTimestamp() == nil {
+		l.Info("Deleting object", zap.String("kind", got.GetKind()))
+		err = resource.Delete(ctx, name, metav1.DeleteOptions{})
+		if !errors.IsNotFound(err) {
+			if err == nil {
+				eventf(ctx, got, corev1.EventTypeNormal, ReasonDeleting, "Deleting %s %s", got.GetKind(), got.GetName())
+			}
+			return err
+		}
+		return nil
+	}
+
+	// wait for deletion
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for deletion")
+		case <-ticker.C:
+			_, err = resource.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				if errors.IsNotFound(err) {
+					l.Info("Object deleted")
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
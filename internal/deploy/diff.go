@@ -0,0 +1,117 @@
+package deploy
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/types/known/structpb"
+	v1 "poc-cloud-service/gen/api/v1"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffFields compares the fields of desired with live. Fields only set on live are left out, the cluster defaults some,
+// except in lists which are compared item by item.
+func DiffFields(live, desired interface{}) ([]*v1.FieldDiff, error) {
+	return diffFields("", live, desired, false)
+}
+
+// diffFields compares live and desired under path, fields only set on live are kept when removed is set
+func diffFields(path string, live, desired interface{}, removed bool) ([]*v1.FieldDiff, error) {
+	switch desiredValue := desired.(type) {
+	case map[string]interface{}:
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(desiredValue))
+		for k := range desiredValue {
+			keys = append(keys, k)
+		}
+		if removed {
+			for k := range liveMap {
+				if _, ok := desiredValue[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+		}
+		sort.Strings(keys)
+		var diffs []*v1.FieldDiff
+		for _, k := range keys {
+			fieldPath := path + "/" + escapePointer(k)
+			liveField, inLive := liveMap[k]
+			desiredField, inDesired := desiredValue[k]
+			var fieldDiffs []*v1.FieldDiff
+			var err error
+			switch {
+			case !inLive:
+				fieldDiffs, err = newFieldDiffs(fieldPath, nil, desiredField)
+			case !inDesired:
+				fieldDiffs, err = newFieldDiffs(fieldPath, liveField, nil)
+			default:
+				fieldDiffs, err = diffFields(fieldPath, liveField, desiredField, removed)
+			}
+			if err != nil {
+				return nil, err
+			}
+			diffs = append(diffs, fieldDiffs...)
+		}
+		return diffs, nil
+	case []interface{}:
+		liveList, ok := live.([]interface{})
+		if !ok {
+			break
+		}
+		var diffs []*v1.FieldDiff
+		for i := 0; i < len(desiredValue) || i < len(liveList); i++ {
+			fieldPath := fmt.Sprintf("%s/%d", path, i)
+			var fieldDiffs []*v1.FieldDiff
+			var err error
+			switch {
+			case i >= len(liveList):
+				fieldDiffs, err = newFieldDiffs(fieldPath, nil, desiredValue[i])
+			case i >= len(desiredValue):
+				fieldDiffs, err = newFieldDiffs(fieldPath, liveList[i], nil)
+			default:
+				fieldDiffs, err = diffFields(fieldPath, liveList[i], desiredValue[i], removed)
+			}
+			if err != nil {
+				return nil, err
+			}
+			diffs = append(diffs, fieldDiffs...)
+		}
+		return diffs, nil
+	}
+	if reflect.DeepEqual(live, desired) {
+		return nil, nil
+	}
+	return newFieldDiffs(path, live, desired)
+}
+
+func newFieldDiffs(path string, live, desired interface{}) ([]*v1.FieldDiff, error) {
+	fieldDiff, err := newFieldDiff(path, live, desired)
+	if err != nil {
+		return nil, err
+	}
+	return []*v1.FieldDiff{fieldDiff}, nil
+}
+
+func newFieldDiff(path string, live, desired interface{}) (*v1.FieldDiff, error) {
+	fieldDiff := &v1.FieldDiff{Path: path}
+	var err error
+	if live != nil {
+		if fieldDiff.Live, err = structpb.NewValue(live); err != nil {
+			return nil, err
+		}
+	}
+	if desired != nil {
+		if fieldDiff.Desired, err = structpb.NewValue(desired); err != nil {
+			return nil, err
+		}
+	}
+	return fieldDiff, nil
+}
+
+// escapePointer escapes a key for a JSON pointer
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
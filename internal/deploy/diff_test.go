@@ -0,0 +1,89 @@
+package deploy
+
+import (
+	"fmt"
+	v1 "poc-cloud-service/gen/api/v1"
+	"reflect"
+	"testing"
+)
+
+func TestDiffFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		live    interface{}
+		desired interface{}
+		want    []string
+	}{
+		{
+			name:    "equal",
+			live:    map[string]interface{}{"a": "x", "b": 1.0},
+			desired: map[string]interface{}{"a": "x", "b": 1.0},
+		},
+		{
+			name:    "changed and added fields",
+			live:    map[string]interface{}{"a": "x"},
+			desired: map[string]interface{}{"a": "y", "b": true},
+			want:    []string{"/a: x -> y", "/b: <nil> -> true"},
+		},
+		{
+			name:    "fields only set on live are left out",
+			live:    map[string]interface{}{"a": "x", "status": map[string]interface{}{"phase": "Active"}},
+			desired: map[string]interface{}{"a": "x"},
+		},
+		{
+			name:    "nested fields",
+			live:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 1.0, "paused": false}},
+			desired: map[string]interface{}{"spec": map[string]interface{}{"replicas": 3.0}},
+			want:    []string{"/spec/replicas: 1 -> 3"},
+		},
+		{
+			name: "list items are added and removed, their fields only set on live are left out",
+			live: map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"name": "a", "default": "x"},
+				"removed",
+			}},
+			desired: map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"name": "b"},
+			}},
+			want: []string{"/items/0/name: a -> b", "/items/1: removed -> <nil>"},
+		},
+		{
+			name:    "type change",
+			live:    map[string]interface{}{"a": map[string]interface{}{"b": "c"}},
+			desired: map[string]interface{}{"a": "b"},
+			want:    []string{"/a: map[b:c] -> b"},
+		},
+		{
+			name:    "escaped keys",
+			live:    map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "x"}},
+			desired: map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "y", "a~b": "z"}},
+			want:    []string{"/labels/app.kubernetes.io~1name: x -> y", "/labels/a~0b: <nil> -> z"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, err := DiffFields(tt.live, tt.desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatDiffs(diffs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffFields() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func formatDiffs(diffs []*v1.FieldDiff) []string {
+	var formatted []string
+	for _, diff := range diffs {
+		var live, desired interface{}
+		if diff.GetLive() != nil {
+			live = diff.GetLive().AsInterface()
+		}
+		if diff.GetDesired() != nil {
+			desired = diff.GetDesired().AsInterface()
+		}
+		formatted = append(formatted, fmt.Sprintf("%s: %v -> %v", diff.GetPath(), live, desired))
+	}
+	return formatted
+}
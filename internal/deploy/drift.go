@@ -0,0 +1,155 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"strings"
+)
+
+// Drift is an out of band change to an object written for a tenant
+type Drift struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	UID        types.UID
+	// Fields are the changed fields, live holding the value found on the object
+	Fields []*v1.FieldDiff
+	// Digest identifies the drifted state of the object, the same drift is found again while it is not corrected
+	Digest string
+	// Corrected is unset in report only mode, where drifted objects are left as found
+	Corrected bool
+}
+
+// DriftRecorder records the drifts found while ensuring the objects of a tenant
+type DriftRecorder func(ctx context.Context, drift Drift) error
+
+type driftKey struct{}
+
+type driftOptions struct {
+	recorder   DriftRecorder
+	reportOnly bool
+}
+
+// WithDriftRecorder returns a context under which drifts found by Ensure are passed to recorder,
+// drifted objects are left as found when reportOnly is set. Drifts are corrected silently otherwise.
+func WithDriftRecorder(ctx context.Context, recorder DriftRecorder, reportOnly bool) context.Context {
+	return context.WithValue(ctx, driftKey{}, driftOptions{recorder: recorder, reportOnly: reportOnly})
+}
+
+// RecordDrift passes the drift of an object to the recorder of the context, and tells whether it should be corrected.
+// The fields that may hold secrets are redacted before they are recorded.
+func RecordDrift(ctx context.Context, drift Drift) (bool, error) {
+	options, ok := ctx.Value(driftKey{}).(driftOptions)
+	if !ok {
+		return true, nil
+	}
+	drift.Fields = redactDriftFields(drift.Kind, drift.Fields)
+	drift.Corrected = !options.reportOnly
+	if err := options.recorder(ctx, drift); err != nil {
+		return false, err
+	}
+	return drift.Corrected, nil
+}
+
+// recordSpecDrift records the drift of the spec of an object from the one the service last wrote.
+// Objects the service has not annotated yet are not considered drifted.
+func recordSpecDrift(ctx context.Context, got *unstructured.Unstructured, wantSpec interface{}) (drifted bool, correct bool, err error) {
+	applied := got.GetAnnotations()[constants.AppliedSpecAnnotation]
+	gotDigest, err := specDigest(got.Object["spec"])
+	if err != nil {
+		return false, false, err
+	}
+	if applied == "" || applied == gotDigest {
+		return false, true, nil
+	}
+	fields, err := diffFields("/spec", got.Object["spec"], wantSpec, true)
+	if err != nil {
+		return false, false, err
+	}
+	correct, err = RecordDrift(ctx, Drift{
+		APIVersion: got.GetAPIVersion(),
+		Kind:       got.GetKind(),
+		Namespace:  got.GetNamespace(),
+		Name:       got.GetName(),
+		UID:        got.GetUID(),
+		Fields:     fields,
+		Digest:     gotDigest,
+	})
+	return true, correct, err
+}
+
+// setAppliedSpec annotates an object with the digest of its spec, and tells whether the annotation changed
+func setAppliedSpec(obj *unstructured.Unstructured) (bool, error) {
+	d, err := specDigest(obj.Object["spec"])
+	if err != nil {
+		return false, err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations[constants.AppliedSpecAnnotation] == d {
+		return false, nil
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[constants.AppliedSpecAnnotation] = d
+	obj.SetAnnotations(annotations)
+	return true, nil
+}
+
+func specDigest(spec interface{}) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return digest(data), nil
+}
+
+// redactDriftFields replaces the values of the fields that may hold secrets by keyed digests, like previews do:
+// the data of Secrets and the helm values of applications and HelmReleases
+func redactDriftFields(kind string, fields []*v1.FieldDiff) []*v1.FieldDiff {
+	redacted := make([]*v1.FieldDiff, len(fields))
+	for i, field := range fields {
+		if !isSecretField(kind, field.GetPath()) {
+			redacted[i] = field
+			continue
+		}
+		redacted[i] = &v1.FieldDiff{
+			Path:    field.GetPath(),
+			Live:    redactedValue(field.GetLive()),
+			Desired: redactedValue(field.GetDesired()),
+		}
+	}
+	return redacted
+}
+
+// isSecretField tells whether the field at a JSON pointer of an object of kind may hold secrets
+func isSecretField(kind, path string) bool {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	switch kind {
+	case "Secret":
+		return segments[0] == "data" || segments[0] == "stringData"
+	case constants.FluxHelmReleaseGVK.Kind:
+		return len(segments) > 1 && segments[0] == "spec" && segments[1] == "values"
+	}
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] == "helm" && (segments[i+1] == "values" || segments[i+1] == "valuesObject") {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedValue replaces a value by its keyed digest, unset values stay unset
+func redactedValue(value *structpb.Value) *structpb.Value {
+	if value == nil {
+		return nil
+	}
+	data, _ := json.Marshal(value.AsInterface())
+	return structpb.NewStringValue(redactedDigest(data))
+}
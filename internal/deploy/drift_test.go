@@ -0,0 +1,64 @@
+package deploy
+
+import (
+	"context"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	v1 "poc-cloud-service/gen/api/v1"
+	"strings"
+	"testing"
+)
+
+func TestRecordDriftRedactsSecrets(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		path     string
+		redacted bool
+	}{
+		{name: "application values", kind: "Application", path: "/spec/source/helm/valuesObject/db/password", redacted: true},
+		{name: "application values string", kind: "Application", path: "/spec/source/helm/values", redacted: true},
+		{name: "application sources values", kind: "Application", path: "/spec/sources/0/helm/valuesObject", redacted: true},
+		{name: "application revision", kind: "Application", path: "/spec/source/targetRevision", redacted: false},
+		{name: "helm release values", kind: "HelmRelease", path: "/spec/values/db/password", redacted: true},
+		{name: "helm release interval", kind: "HelmRelease", path: "/spec/interval", redacted: false},
+		{name: "secret data", kind: "Secret", path: "/data/values.yaml", redacted: true},
+		{name: "secret string data", kind: "Secret", path: "/stringData/token", redacted: true},
+		{name: "secret labels", kind: "Secret", path: "/metadata/labels/tenant", redacted: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := &v1.FieldDiff{
+				Path:    tt.path,
+				Live:    structpb.NewStringValue("hunter2"),
+				Desired: structpb.NewStringValue("changeme"),
+			}
+			var recorded Drift
+			ctx := WithDriftRecorder(context.Background(), func(ctx context.Context, drift Drift) error {
+				recorded = drift
+				return nil
+			}, false)
+			if _, err := RecordDrift(ctx, Drift{Kind: tt.kind, Fields: []*v1.FieldDiff{field}}); err != nil {
+				t.Fatal(err)
+			}
+			if len(recorded.Fields) != 1 || recorded.Fields[0].GetPath() != tt.path {
+				t.Fatalf("recorded fields = %v, want the field at %s", recorded.Fields, tt.path)
+			}
+			got := recorded.Fields[0]
+			if !tt.redacted {
+				if !proto.Equal(got, field) {
+					t.Errorf("field = %v, want %v", got, field)
+				}
+				return
+			}
+			for _, value := range []*structpb.Value{got.GetLive(), got.GetDesired()} {
+				if !strings.HasPrefix(value.GetStringValue(), "hmac-sha256:") {
+					t.Errorf("value = %v, want a keyed digest", value)
+				}
+			}
+			if got.GetLive().GetStringValue() == got.GetDesired().GetStringValue() {
+				t.Errorf("different values have the same digest")
+			}
+		})
+	}
+}
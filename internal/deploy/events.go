@@ -0,0 +1,30 @@
+package deploy
+
+import (
+	"context"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the Events on the objects written for tenants
+const (
+	ReasonCreated  = "Created"
+	ReasonUpdated  = "Updated"
+	ReasonDeleting = "Deleting"
+)
+
+type eventRecorderKey struct{}
+
+// WithEventRecorder returns a context under which the objects written by Ensure and deleted by Delete get Events
+func WithEventRecorder(ctx context.Context, recorder record.EventRecorder) context.Context {
+	return context.WithValue(ctx, eventRecorderKey{}, recorder)
+}
+
+// eventf records an Event on an object with the recorder of the context, if any
+func eventf(ctx context.Context, obj runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	recorder, ok := ctx.Value(eventRecorderKey{}).(record.EventRecorder)
+	if !ok {
+		return
+	}
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
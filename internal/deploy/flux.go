@@ -0,0 +1,435 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"path"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/charts"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	fluxInterval   = "1m"
+	readyType      = "Ready"
+	fluxHealthy    = "Healthy"
+	fluxDegraded   = "Degraded"
+	fluxProgress   = "Progressing"
+	conditionTrue  = "True"
+	conditionFalse = "False"
+	// fluxRequestedAt asks the controllers to reconcile an object now, fluxForceAt also forces a helm upgrade
+	fluxRequestedAt = "reconcile.fluxcd.io/requestedAt"
+	fluxForceAt     = "reconcile.fluxcd.io/forceAt"
+)
+
+var (
+	commitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// tagRegexp matches version tags such as v1.2.3 or 1.2.3-rc.1, which are not branch names in practice
+	tagRegexp = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+)+([-+][0-9A-Za-z.+-]*)?$`)
+)
+
+// Flux deploys tenants as a Flux GitRepository and HelmRelease pair, both named after the deployment
+type Flux struct {
+	client        kubernetes.Interface
+	dynamicClient dynamic.Interface
+	informer      informers.GenericInformer
+}
+
+func NewFlux(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface) *Flux {
+	return &Flux{
+		client:        client,
+		dynamicClient: dynamicClient,
+		informer:      startInformer(ctx, dynamicClient, constants.FluxNamespace, constants.FluxHelmReleasesGVR),
+	}
+}
+
+// HasSynced tells whether the informer cache is synced
+func (f *Flux) HasSynced() bool {
+	return f.informer.Informer().HasSynced()
+}
+
+func (f *Flux) Ensure(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) error {
+	if err := checkFluxTenant(tenant); err != nil {
+		return err
+	}
+	// Only the source of the tenant kind exists, the other one is left over from a previous kind
+	if tenant.GetSource().GetChart() != nil {
+		if err := ensureObject(ctx, f.helmRepositories(), makeHelmRepository(name, tenant)); err != nil {
+			return err
+		}
+		if err := deleteObject(ctx, f.gitRepositories(), name); err != nil {
+			return err
+		}
+	} else {
+		if err := ensureObject(ctx, f.gitRepositories(), makeGitRepository(name, tenant)); err != nil {
+			return err
+		}
+		if err := deleteObject(ctx, f.helmRepositories(), name); err != nil {
+			return err
+		}
+	}
+	// The helm-controller only reads values from Secrets next to the HelmRelease
+	if err := ensureSecretValues(ctx, f.client, constants.FluxNamespace, constants.SecretValuesNameForDeployment(name), tenant); err != nil {
+		return err
+	}
+	helmRelease, err := makeHelmRelease(name, tenant, target)
+	if err != nil {
+		return err
+	}
+	return ensureObject(ctx, f.helmReleases(), helmRelease)
+}
+
+func (f *Flux) Preview(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) ([]Change, error) {
+	if err := checkFluxTenant(tenant); err != nil {
+		return nil, err
+	}
+	var helmRepository, gitRepository *unstructured.Unstructured
+	if tenant.GetSource().GetChart() != nil {
+		helmRepository = makeHelmRepository(name, tenant)
+	} else {
+		gitRepository = makeGitRepository(name, tenant)
+	}
+	helmRelease, err := makeHelmRelease(name, tenant, target)
+	if err != nil {
+		return nil, err
+	}
+	return f.preview(ctx, name, tenant, helmRepository, gitRepository, helmRelease)
+}
+
+func (f *Flux) PreviewDelete(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) ([]Change, error) {
+	return f.preview(ctx, name, nil, nil, nil, nil)
+}
+
+// preview returns the changes to the objects of a deployment, the nil ones are deleted
+func (f *Flux) preview(ctx context.Context, name string, tenant *v1.Tenant, helmRepository, gitRepository, helmRelease *unstructured.Unstructured) ([]Change, error) {
+	changes, err := previewObject(ctx, nil, f.helmRepositories(), name, helmRepository)
+	if err != nil {
+		return nil, err
+	}
+	if changes, err = previewObject(ctx, changes, f.gitRepositories(), name, gitRepository); err != nil {
+		return nil, err
+	}
+	if changes, err = previewSecretValues(ctx, changes, f.client, constants.FluxNamespace, constants.SecretValuesNameForDeployment(name), tenant); err != nil {
+		return nil, err
+	}
+	return previewObject(ctx, changes, f.helmReleases(), name, helmRelease)
+}
+
+func (f *Flux) Delete(ctx context.Context, name string) error {
+	if err := deleteObject(ctx, f.helmReleases(), name); err != nil {
+		return err
+	}
+	if err := deleteSecretValues(ctx, f.client, constants.FluxNamespace, constants.SecretValuesNameForDeployment(name)); err != nil {
+		return err
+	}
+	if err := deleteObject(ctx, f.helmRepositories(), name); err != nil {
+		return err
+	}
+	return deleteObject(ctx, f.gitRepositories(), name)
+}
+
+// Release suspends the HelmRelease before deleting it, the helm-controller does not uninstall suspended releases
+func (f *Flux) Release(ctx context.Context, name string) error {
+	patch := []byte(`{"spec":{"suspend":true}}`)
+	if _, err := f.helmReleases().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to suspend HelmRelease: %w", err)
+	}
+	return f.Delete(ctx, name)
+}
+
+// Observe maps the HelmRelease Ready condition to an Argo CD like health
+func (f *Flux) Observe(ctx context.Context, name string) (*v1.Application, error) {
+	obj, err := getCached(f.informer, constants.FluxNamespace, name)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	health := &v1.Health{Status: fluxProgress}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != readyType {
+			continue
+		}
+		health.Message, _ = condition["message"].(string)
+		switch condition["status"] {
+		case conditionTrue:
+			health.Status = fluxHealthy
+		case conditionFalse:
+			health.Status = fluxDegraded
+		}
+	}
+	return &v1.Application{Health: health}, nil
+}
+
+// Sync requests a reconciliation of the HelmRelease, Flux has no selective, pruning or dry-run sync
+func (f *Flux) Sync(ctx context.Context, name string, options SyncOptions) (*v1.Application, error) {
+	if options.Prune || options.DryRun || len(options.Resources) > 0 {
+		return nil, ErrUnsupported
+	}
+	now := time.Now().Format(time.RFC3339Nano)
+	annotations := map[string]interface{}{fluxRequestedAt: now}
+	if options.Force {
+		annotations[fluxForceAt] = now
+	}
+	if err := requestReconcile(ctx, f.helmReleases(), name, annotations); err != nil {
+		return nil, err
+	}
+	return f.Observe(ctx, name)
+}
+
+// Refresh requests a fetch of the source of the deployment, Flux always fetches the full source
+func (f *Flux) Refresh(ctx context.Context, name string, hard bool) (*v1.Application, error) {
+	annotations := map[string]interface{}{fluxRequestedAt: time.Now().Format(time.RFC3339Nano)}
+	err := requestReconcile(ctx, f.helmRepositories(), name, annotations)
+	// Only the repository of the source kind exists
+	if err == ErrNotFound {
+		err = requestReconcile(ctx, f.gitRepositories(), name, annotations)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.Observe(ctx, name)
+}
+
+func (f *Flux) TerminateOperation(ctx context.Context, name string) (*v1.Application, error) {
+	return nil, ErrUnsupported
+}
+
+// Import is not supported, tenants are only adopted from Argo CD applications
+func (f *Flux) Import(ctx context.Context, name string) (*v1.Tenant, error) {
+	return nil, ErrUnsupported
+}
+
+// requestReconcile sets reconcile request annotations on a Flux object
+func requestReconcile(ctx context.Context, resource dynamic.ResourceInterface, name string, annotations map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := resource.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		if errors.IsNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Resources is nil, the helm-controller keeps no inventory of what it deployed
+func (f *Flux) Resources(ctx context.Context, name string) ([]*v1.TenantResource, error) {
+	return nil, nil
+}
+
+// NamespaceLabels is empty, Flux does not need namespaces to opt in
+func (f *Flux) NamespaceLabels() map[string]string {
+	return map[string]string{}
+}
+
+func (f *Flux) gitRepositories() dynamic.ResourceInterface {
+	return f.dynamicClient.Resource(constants.FluxGitRepositoriesGVR).Namespace(constants.FluxNamespace)
+}
+
+func (f *Flux) helmRepositories() dynamic.ResourceInterface {
+	return f.dynamicClient.Resource(constants.FluxHelmRepositoriesGVR).Namespace(constants.FluxNamespace)
+}
+
+func (f *Flux) helmReleases() dynamic.ResourceInterface {
+	return f.dynamicClient.Resource(constants.FluxHelmReleasesGVR).Namespace(constants.FluxNamespace)
+}
+
+// checkFluxTenant rejects the tenant options the flux backend cannot deploy
+func checkFluxTenant(tenant *v1.Tenant) error {
+	if len(tenant.GetSources()) > 0 {
+		return fmt.Errorf("the flux backend does not support multiple sources")
+	}
+	if !isHelmSource(tenant.GetSource()) {
+		return fmt.Errorf("the flux backend does not support %s sources", tenant.GetSource().GetType())
+	}
+	if len(tenant.GetSource().GetHelm().GetFileParameters()) > 0 {
+		return fmt.Errorf("the flux backend does not support helm file parameters")
+	}
+	return nil
+}
+
+func fluxLabels(tenant *v1.Tenant) map[string]string {
+	return map[string]string{
+		constants.IsTenantLabel: "true",
+		constants.TenantLabel:   tenant.GetId(),
+	}
+}
+
+// makeGitRepository creates the Flux source for the tenant repository.
+// Full commit shas are pinned, any other revision is tracked as a branch.
+func makeGitRepository(name string, tenant *v1.Tenant) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetNamespace(constants.FluxNamespace)
+	u.SetName(name)
+	u.SetLabels(fluxLabels(tenant))
+	u.SetGroupVersionKind(constants.FluxGitRepositoryGVK)
+
+	repoURL := constants.DefaultRepoURL
+	if url := tenant.GetSource().GetRepoUrl(); len(url) > 0 {
+		repoURL = url
+	}
+
+	spec := map[string]interface{}{
+		"url":      repoURL,
+		"interval": fluxInterval,
+	}
+	if targetRevision := tenant.GetSource().GetTargetRevision(); len(targetRevision) > 0 && targetRevision != "HEAD" {
+		spec["ref"] = gitRepositoryRef(targetRevision)
+	}
+	u.Object["spec"] = spec
+	return u
+}
+
+// gitRepositoryRef maps a target revision to the ref of a GitRepository: full references such as refs/tags/v1 or
+// refs/heads/main are passed as is, a commit SHA and a version tag are recognized, anything else is a branch
+func gitRepositoryRef(revision string) map[string]interface{} {
+	switch {
+	case strings.HasPrefix(revision, "refs/"):
+		return map[string]interface{}{"name": revision}
+	case commitRegexp.MatchString(revision):
+		return map[string]interface{}{"commit": revision}
+	case tagRegexp.MatchString(revision):
+		return map[string]interface{}{"tag": revision}
+	default:
+		return map[string]interface{}{"branch": revision}
+	}
+}
+
+// makeHelmRepository creates the Flux source for the tenant chart repository or OCI registry
+func makeHelmRepository(name string, tenant *v1.Tenant) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetNamespace(constants.FluxNamespace)
+	u.SetName(name)
+	u.SetLabels(fluxLabels(tenant))
+	u.SetGroupVersionKind(constants.FluxHelmRepositoryGVK)
+
+	repoURL := tenant.GetSource().GetChart().GetRepoUrl()
+	spec := map[string]interface{}{
+		"url":      repoURL,
+		"interval": fluxInterval,
+	}
+	if strings.HasPrefix(repoURL, ociScheme) {
+		spec["type"] = "oci"
+	}
+	u.Object["spec"] = spec
+	return u
+}
+
+// makeHelmRelease creates the HelmRelease installing the tenant chart from its GitRepository or HelmRepository.
+// Remote clusters are reached through their kubeconfig secret, which must exist in the Flux namespace.
+func makeHelmRelease(name string, tenant *v1.Tenant, target *cluster.Target) (*unstructured.Unstructured, error) {
+	u := &unstructured.Unstructured{}
+	u.SetNamespace(constants.FluxNamespace)
+	u.SetName(name)
+	u.SetLabels(fluxLabels(tenant))
+	u.SetGroupVersionKind(constants.FluxHelmReleaseGVK)
+
+	chartSpec := map[string]interface{}{
+		"chart":             constants.DefaultRepoPath,
+		"reconcileStrategy": "Revision",
+		"sourceRef": map[string]interface{}{
+			"kind":      constants.FluxGitRepositoryGVK.Kind,
+			"name":      name,
+			"namespace": constants.FluxNamespace,
+		},
+	}
+	if chart := tenant.GetSource().GetChart(); chart != nil {
+		chartSpec["chart"] = chart.GetName()
+		chartSpec["version"] = latestChartVersion
+		if version := chart.GetVersion(); len(version) > 0 {
+			chartSpec["version"] = version
+		}
+		chartSpec["reconcileStrategy"] = "ChartVersion"
+		chartSpec["sourceRef"] = map[string]interface{}{
+			"kind":      constants.FluxHelmRepositoryGVK.Kind,
+			"name":      name,
+			"namespace": constants.FluxNamespace,
+		}
+	} else if path := tenant.GetSource().GetPath(); len(path) > 0 {
+		chartSpec["chart"] = path
+	}
+	if valueFiles := tenant.GetSource().GetHelm().GetValueFiles(); len(valueFiles) > 0 {
+		// Flux reads value files from the source root and drops the chart values.yaml once any is set
+		chartRoot := ""
+		if tenant.GetSource().GetChart() == nil {
+			chartRoot = chartSpec["chart"].(string)
+		}
+		files := []interface{}{path.Join(chartRoot, chartutil.ValuesfileName)}
+		for _, valueFile := range valueFiles {
+			if _, _, ok := charts.ValueFileRef(valueFile); ok {
+				return nil, fmt.Errorf("the flux backend does not support value files from other sources")
+			}
+			files = append(files, path.Join(chartRoot, valueFile))
+		}
+		chartSpec["valuesFiles"] = files
+	}
+	namespace := constants.NamespaceNameForTenant(tenant.GetId())
+
+	spec := map[string]interface{}{
+		"interval":         fluxInterval,
+		"releaseName":      namespace,
+		"targetNamespace":  namespace,
+		"storageNamespace": namespace,
+		"chart": map[string]interface{}{
+			"spec": chartSpec,
+		},
+	}
+	values := tenant.GetSource().GetHelm().GetValues().AsMap()
+	if err := charts.ApplyParameters(values, tenant.GetSource().GetHelm().GetParameters()); err != nil {
+		return nil, err
+	}
+	if len(values) > 0 {
+		// decode through the apimachinery json package so numbers compare equal to what the API returns
+		valuesJson, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		var valuesObj map[string]interface{}
+		if err := json.Unmarshal(valuesJson, &valuesObj); err != nil {
+			return nil, err
+		}
+		spec["values"] = valuesObj
+	}
+	if tenant.GetSuspended() {
+		spec["suspend"] = true
+	}
+	if len(tenant.GetSource().GetHelm().GetSecretValues().GetFields()) > 0 {
+		// Flux merges valuesFrom before values, inline values and parameters win over secret values as in charts.Values.
+		// valuesFrom only reads Secrets in the namespace of the HelmRelease, which may not be on the tenant cluster.
+		spec["valuesFrom"] = []interface{}{
+			map[string]interface{}{
+				"kind":      "Secret",
+				"name":      constants.SecretValuesNameForDeployment(name),
+				"valuesKey": constants.SecretValuesKey,
+			},
+		}
+	}
+	if target.KubeconfigSecret != "" {
+		spec["kubeConfig"] = map[string]interface{}{
+			"secretRef": map[string]interface{}{
+				"name": target.KubeconfigSecret,
+				"key":  constants.KubeconfigSecretKey,
+			},
+		}
+	}
+	u.Object["spec"] = spec
+	return u, nil
+}
@@ -0,0 +1,71 @@
+package deploy
+
+import (
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"reflect"
+	"testing"
+)
+
+func TestGitRepositoryRef(t *testing.T) {
+	tests := []struct {
+		revision string
+		want     map[string]interface{}
+	}{
+		{"main", map[string]interface{}{"branch": "main"}},
+		{"release/1.x", map[string]interface{}{"branch": "release/1.x"}},
+		{"v1.2.3", map[string]interface{}{"tag": "v1.2.3"}},
+		{"1.2.3-rc.1", map[string]interface{}{"tag": "1.2.3-rc.1"}},
+		{"v1.2", map[string]interface{}{"tag": "v1.2"}},
+		{"refs/tags/stable", map[string]interface{}{"name": "refs/tags/stable"}},
+		{"refs/heads/v1.2.3", map[string]interface{}{"name": "refs/heads/v1.2.3"}},
+		{"0123456789abcdef0123456789abcdef01234567", map[string]interface{}{"commit": "0123456789abcdef0123456789abcdef01234567"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.revision, func(t *testing.T) {
+			if got := gitRepositoryRef(tt.revision); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gitRepositoryRef(%q) = %v, want %v", tt.revision, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMakeHelmReleaseSecretValues pins the precedence of charts.Values: Flux merges valuesFrom, the secret values,
+// before values, which hold the inline values and parameters
+func TestMakeHelmReleaseSecretValues(t *testing.T) {
+	values, _ := structpb.NewStruct(map[string]interface{}{"greeting": "bonjour"})
+	secretValues, _ := structpb.NewStruct(map[string]interface{}{"greeting": "secret"})
+	tenant := &v1.Tenant{
+		Id: "t1",
+		Source: &v1.Source{
+			RepoUrl: "https://github.com/org/repo",
+			Path:    "chart",
+			Helm: &v1.Helm{
+				Values:       values,
+				SecretValues: secretValues,
+				Parameters:   []*v1.HelmParameter{{Name: "replicas", Value: "2"}},
+			},
+		},
+	}
+	helmRelease, err := makeHelmRelease("acs-t1", tenant, &cluster.Target{Server: constants.InClusterServer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotValues, _, _ := unstructured.NestedMap(helmRelease.Object, "spec", "values")
+	wantValues := map[string]interface{}{"greeting": "bonjour", "replicas": int64(2)}
+	if !reflect.DeepEqual(gotValues, wantValues) {
+		t.Errorf("values = %v, want %v", gotValues, wantValues)
+	}
+	valuesFrom, _, _ := unstructured.NestedSlice(helmRelease.Object, "spec", "valuesFrom")
+	wantValuesFrom := []interface{}{map[string]interface{}{
+		"kind":      "Secret",
+		"name":      "acs-t1-secret-values",
+		"valuesKey": constants.SecretValuesKey,
+	}}
+	if !reflect.DeepEqual(valuesFrom, wantValuesFrom) {
+		t.Errorf("valuesFrom = %v, want %v", valuesFrom, wantValuesFrom)
+	}
+}
@@ -0,0 +1,565 @@
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/charts"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/log"
+	"strings"
+	"sync"
+)
+
+// helmMaxHistory is the number of release revisions kept in the tenant namespace
+const helmMaxHistory = 10
+
+// Labels set on the releases, to find the release of a deployment and what it was deployed from after a restart
+const (
+	helmDeploymentLabel = "poc-cloud-service/deployment"
+	helmDigestLabel     = "poc-cloud-service/digest"
+)
+
+// Helm installs tenant charts directly with the Helm SDK, without a GitOps engine in the cluster.
+// The release of a tenant is called after its namespace and stored in it.
+type Helm struct {
+	charts *charts.Fetcher
+	// targets lists the clusters releases may be installed on
+	targets func(ctx context.Context) (map[string]*cluster.Target, error)
+	// actionConfig builds the Helm configuration for a namespace of a target, replaced in tests by a fake kube client
+	actionConfig func(target *cluster.Target, namespace string) (*action.Configuration, error)
+
+	mu sync.Mutex
+	// getters holds the clients of each server, replaced when the cluster registry rebuilds its config
+	getters  map[string]*restClientGetter
+	releases map[string]*helmRelease
+}
+
+// helmRelease records where a deployment was installed, Delete and Observe only get its name.
+// Records are lost on restart and rebuilt from the release labels by find.
+type helmRelease struct {
+	name      string
+	namespace string
+	target    *cluster.Target
+	digest    string
+}
+
+func NewHelm(fetcher *charts.Fetcher, targets func(ctx context.Context) (map[string]*cluster.Target, error)) *Helm {
+	h := &Helm{
+		charts:   fetcher,
+		targets:  targets,
+		getters:  map[string]*restClientGetter{},
+		releases: map[string]*helmRelease{},
+	}
+	h.actionConfig = h.restActionConfig
+	return h
+}
+
+func (h *Helm) Ensure(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) error {
+	l := log.FromContext(ctx).With(zap.String("name", name))
+	// The release of a suspended tenant is left as it is
+	if tenant.GetSuspended() {
+		return nil
+	}
+	c, values, err := h.load(ctx, tenant)
+	if err != nil {
+		return err
+	}
+	digest, err := releaseDigest(c.Chart, values, target.Server)
+	if err != nil {
+		return err
+	}
+
+	namespace := constants.NamespaceNameForTenant(tenant.GetId())
+	recorded, err := h.findAll(ctx, name)
+	if err != nil {
+		return err
+	}
+	// The release is not carried over when the tenant changes cluster, the previous one is uninstalled first
+	if recorded != nil && recorded.target.Server != target.Server {
+		if err := h.uninstall(ctx, recorded); err != nil {
+			return err
+		}
+		if err := h.Release(ctx, name); err != nil {
+			return err
+		}
+		recorded = nil
+	}
+
+	cfg, err := h.actionConfig(target, namespace)
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]string{
+		helmDeploymentLabel: name,
+		helmDigestLabel:     digest,
+	}
+	history := action.NewHistory(cfg)
+	history.Max = 1
+	var rel *release.Release
+	// The release is looked up before comparing digests, to install it again when it was uninstalled out of band
+	if _, err := history.Run(namespace); errors.Is(err, driver.ErrReleaseNotFound) {
+		l.Info("Installing release", zap.String("revision", c.Revision))
+		install := action.NewInstall(cfg)
+		install.ReleaseName = namespace
+		install.Namespace = namespace
+		install.Labels = labels
+		rel, err = install.RunWithContext(ctx, c.Chart, values)
+	} else if err != nil {
+		return fmt.Errorf("failed to get release history: %w", err)
+	} else if recorded != nil && recorded.digest == digest {
+		return nil
+	} else {
+		l.Info("Upgrading release", zap.String("revision", c.Revision))
+		upgrade := action.NewUpgrade(cfg)
+		upgrade.Namespace = namespace
+		upgrade.MaxHistory = helmMaxHistory
+		upgrade.Labels = labels
+		rel, err = upgrade.RunWithContext(ctx, namespace, c.Chart, values)
+	}
+
+	// A release that was created but failed is reported by Observe, it is retried when the tenant changes
+	if rel != nil {
+		h.mu.Lock()
+		h.releases[name] = &helmRelease{
+			name:      namespace,
+			namespace: namespace,
+			target:    target,
+			digest:    digest,
+		}
+		h.mu.Unlock()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to deploy release: %w", err)
+	}
+	return nil
+}
+
+// load returns the chart of a tenant and the values it is installed with
+func (h *Helm) load(ctx context.Context, tenant *v1.Tenant) (*charts.Chart, map[string]interface{}, error) {
+	if !isHelmSource(tenant.GetSource()) {
+		return nil, nil, fmt.Errorf("the helm backend does not support %s sources", tenant.GetSource().GetType())
+	}
+	c, err := h.charts.Load(ctx, tenant.GetSource())
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, source := range tenant.GetSources() {
+		if source.GetRef() == "" || source.GetPath() != "" || source.GetChart() != nil {
+			return nil, nil, fmt.Errorf("the helm backend only supports additional sources holding value files")
+		}
+	}
+	values, err := h.charts.Values(ctx, tenant.GetSource(), tenant.GetSources(), c.Chart)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, values, nil
+}
+
+// find returns where the release of a deployment is installed, looking for it on targets when it is not recorded.
+// It is nil when no target has it.
+func (h *Helm) find(ctx context.Context, name string, targets map[string]*cluster.Target) (*helmRelease, error) {
+	h.mu.Lock()
+	recorded, ok := h.releases[name]
+	h.mu.Unlock()
+	if ok {
+		return recorded, nil
+	}
+
+	// Several cluster ids may point to the same server
+	servers := map[string]bool{}
+	for _, target := range targets {
+		if servers[target.Server] {
+			continue
+		}
+		servers[target.Server] = true
+		cfg, err := h.actionConfig(target, "")
+		if err != nil {
+			return nil, err
+		}
+		list := action.NewList(cfg)
+		list.AllNamespaces = true
+		list.StateMask = action.ListAll
+		list.Selector = helmDeploymentLabel + "=" + name
+		releases, err := list.Run()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list releases on %s: %w", target.Server, err)
+		}
+		if len(releases) == 0 {
+			continue
+		}
+		rel := releases[0]
+		recorded = &helmRelease{
+			name:      rel.Name,
+			namespace: rel.Namespace,
+			target:    target,
+			digest:    rel.Labels[helmDigestLabel],
+		}
+		h.mu.Lock()
+		h.releases[name] = recorded
+		h.mu.Unlock()
+		return recorded, nil
+	}
+	return nil, nil
+}
+
+// findAll looks for the release of a deployment on every target
+func (h *Helm) findAll(ctx context.Context, name string) (*helmRelease, error) {
+	targets, err := h.targets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.find(ctx, name, targets)
+}
+
+func (h *Helm) Delete(ctx context.Context, name string) error {
+	recorded, err := h.findAll(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to find release: %w", err)
+	}
+	if recorded == nil {
+		log.FromContext(ctx).Info("No release to uninstall", zap.String("name", name))
+		return nil
+	}
+
+	if err := h.uninstall(ctx, recorded); err != nil {
+		return err
+	}
+	return h.Release(ctx, name)
+}
+
+// uninstall uninstalls a release from the cluster it is recorded on
+func (h *Helm) uninstall(ctx context.Context, recorded *helmRelease) error {
+	cfg, err := h.actionConfig(recorded.target, recorded.namespace)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Uninstalling release", zap.String("name", recorded.name), zap.String("server", recorded.target.Server))
+	if _, err := action.NewUninstall(cfg).Run(recorded.name); err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return fmt.Errorf("failed to uninstall release: %w", err)
+	}
+	return nil
+}
+
+// Release forgets the deployment, the Helm release stays installed
+func (h *Helm) Release(ctx context.Context, name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.releases, name)
+	return nil
+}
+
+func (h *Helm) Observe(ctx context.Context, name string) (*v1.Application, error) {
+	recorded, err := h.findAll(ctx, name)
+	if err != nil || recorded == nil {
+		return nil, err
+	}
+
+	cfg, err := h.actionConfig(recorded.target, recorded.namespace)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := action.NewStatus(cfg).Run(recorded.name)
+	if err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &v1.Application{
+		Health: &v1.Health{
+			Status:  releaseHealth(rel.Info.Status),
+			Message: rel.Info.Description,
+		},
+	}, nil
+}
+
+// Preview renders the chart and compares its objects with the ones of the installed release
+func (h *Helm) Preview(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) ([]Change, error) {
+	c, values, err := h.load(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	namespace := constants.NamespaceNameForTenant(tenant.GetId())
+	desired, err := charts.RenderChart(ctx, c.Chart, values, namespace, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return h.preview(ctx, target, namespace, desired)
+}
+
+func (h *Helm) PreviewDelete(ctx context.Context, name string, tenant *v1.Tenant, target *cluster.Target) ([]Change, error) {
+	return h.preview(ctx, target, constants.NamespaceNameForTenant(tenant.GetId()), nil)
+}
+
+// preview returns the changes from the release installed in namespace to the desired objects.
+// Objects of the release that are not desired anymore are deleted.
+func (h *Helm) preview(ctx context.Context, target *cluster.Target, namespace string, desired []*unstructured.Unstructured) ([]Change, error) {
+	cfg, err := h.actionConfig(target, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var current []*unstructured.Unstructured
+	rel, err := action.NewGet(cfg).Run(namespace)
+	if err == nil {
+		if current, err = charts.ParseManifests(rel.Manifest); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, fmt.Errorf("failed to get release: %w", err)
+	}
+
+	mapper, err := cfg.RESTClientGetter.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(target.Config)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	seen := map[string]bool{}
+	add := func(obj *unstructured.Unstructured, wanted bool) error {
+		gvk := obj.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			if !meta.IsNoMatchError(err) {
+				return err
+			}
+			// The kind is not installed yet, a CRD of the chart for instance
+			if wanted {
+				changes = appendChange(changes, nil, obj)
+			}
+			return nil
+		}
+		var resource dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(namespace)
+			}
+			resource = dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+		}
+		key := strings.Join([]string{gvk.Group, gvk.Kind, obj.GetNamespace(), obj.GetName()}, "/")
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		if wanted {
+			changes, err = previewObject(ctx, changes, resource, obj.GetName(), obj)
+		} else {
+			changes, err = previewObject(ctx, changes, resource, obj.GetName(), nil)
+		}
+		return err
+	}
+	for _, obj := range desired {
+		if err := add(obj, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range current {
+		if err := add(obj, false); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// Sync forgets what the release was deployed from, so that the next reconciliation upgrades it
+func (h *Helm) Sync(ctx context.Context, name string, options SyncOptions) (*v1.Application, error) {
+	if options.Prune || options.Force || options.DryRun || len(options.Resources) > 0 {
+		return nil, ErrUnsupported
+	}
+	recorded, err := h.findAll(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if recorded == nil {
+		return nil, ErrNotFound
+	}
+	h.mu.Lock()
+	recorded.digest = ""
+	h.mu.Unlock()
+	return h.Observe(ctx, name)
+}
+
+// Refresh is not supported, charts are fetched again on every reconciliation once their cache expires
+func (h *Helm) Refresh(ctx context.Context, name string, hard bool) (*v1.Application, error) {
+	return nil, ErrUnsupported
+}
+
+// TerminateOperation is not supported, Helm operations run within a reconciliation
+func (h *Helm) TerminateOperation(ctx context.Context, name string) (*v1.Application, error) {
+	return nil, ErrUnsupported
+}
+
+// Import is not supported, a release does not record the repository of its chart
+func (h *Helm) Import(ctx context.Context, name string) (*v1.Tenant, error) {
+	return nil, ErrUnsupported
+}
+
+// Resources lists the objects of the deployed release, Helm does not track their health
+func (h *Helm) Resources(ctx context.Context, name string) ([]*v1.TenantResource, error) {
+	recorded, err := h.findAll(ctx, name)
+	if err != nil || recorded == nil {
+		return nil, err
+	}
+
+	cfg, err := h.actionConfig(recorded.target, recorded.namespace)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := action.NewGet(cfg).Run(recorded.name)
+	if err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	objects, err := charts.ParseManifests(rel.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]*v1.TenantResource, 0, len(objects))
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		resources = append(resources, &v1.TenantResource{
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		})
+	}
+	return resources, nil
+}
+
+// NamespaceLabels is empty, Helm needs nothing on the namespace
+func (h *Helm) NamespaceLabels() map[string]string {
+	return nil
+}
+
+// releaseHealth maps a Helm release status to the Argo CD health statuses used by the API
+func releaseHealth(status release.Status) string {
+	switch status {
+	case release.StatusDeployed:
+		return "Healthy"
+	case release.StatusFailed:
+		return "Degraded"
+	case release.StatusPendingInstall, release.StatusPendingUpgrade, release.StatusPendingRollback, release.StatusUninstalling:
+		return "Progressing"
+	default:
+		return "Unknown"
+	}
+}
+
+// releaseDigest identifies what a release was deployed from, to skip upgrades when nothing changed.
+// It is cut to fit in a label value.
+func releaseDigest(c *chart.Chart, values map[string]interface{}, server string) (string, error) {
+	hash := sha256.New()
+	var writeChart func(c *chart.Chart)
+	writeChart = func(c *chart.Chart) {
+		for _, f := range c.Raw {
+			hash.Write([]byte(f.Name))
+			hash.Write(f.Data)
+		}
+		for _, dependency := range c.Dependencies() {
+			writeChart(dependency)
+		}
+	}
+	writeChart(c)
+	valuesBytes, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(valuesBytes)
+	hash.Write([]byte(server))
+	return hex.EncodeToString(hash.Sum(nil)[:20]), nil
+}
+
+// restActionConfig builds the Helm configuration from the target rest config, storing releases as secrets
+func (h *Helm) restActionConfig(target *cluster.Target, namespace string) (*action.Configuration, error) {
+	if target.Config == nil {
+		return nil, fmt.Errorf("cluster %s has no rest config", target.ID)
+	}
+
+	h.mu.Lock()
+	getter, ok := h.getters[target.Server]
+	if !ok || getter.config != target.Config {
+		getter = &restClientGetter{config: target.Config, once: &sync.Once{}}
+		h.getters[target.Server] = getter
+	}
+	h.mu.Unlock()
+
+	cfg := &action.Configuration{}
+	if err := cfg.Init(getter.forNamespace(namespace), namespace, "secret", func(string, ...interface{}) {}); err != nil {
+		return nil, fmt.Errorf("failed to init helm: %w", err)
+	}
+	return cfg, nil
+}
+
+// restClientGetter provides Helm the clients of a rest config, sharing discovery between namespaces
+type restClientGetter struct {
+	config    *rest.Config
+	namespace string
+
+	once      *sync.Once
+	discovery discovery.CachedDiscoveryInterface
+	mapper    meta.RESTMapper
+	err       error
+}
+
+var _ genericclioptions.RESTClientGetter = &restClientGetter{}
+
+func (g *restClientGetter) forNamespace(namespace string) *restClientGetter {
+	g.once.Do(func() {
+		client, err := discovery.NewDiscoveryClientForConfig(g.config)
+		if err != nil {
+			g.err = err
+			return
+		}
+		g.discovery = memory.NewMemCacheClient(client)
+		g.mapper = restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(g.discovery), g.discovery, nil)
+	})
+	scoped := *g
+	scoped.namespace = namespace
+	return &scoped
+}
+
+func (g *restClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return rest.CopyConfig(g.config), nil
+}
+
+func (g *restClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	return g.discovery, g.err
+}
+
+func (g *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	return g.mapper, g.err
+}
+
+func (g *restClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return clientcmd.NewDefaultClientConfig(*clientcmdapi.NewConfig(), &clientcmd.ConfigOverrides{
+		Context: clientcmdapi.Context{Namespace: g.namespace},
+	})
+}
@@ -0,0 +1,198 @@
+package deploy
+
+import (
+	"context"
+	"google.golang.org/protobuf/types/known/structpb"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"io"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/charts"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"testing"
+)
+
+const testRepoURL = "https://git.example.com/tenants"
+
+// newTestHelm returns a Helm backend installing on a single cluster whose releases are kept in releases
+func newTestHelm(t *testing.T, releases *driver.Memory) (*Helm, *cluster.Target) {
+	t.Helper()
+	target := &cluster.Target{Server: constants.InClusterServer}
+	fetcher := charts.NewFetcher(t.TempDir(), charts.WithLocalRepo(testRepoURL, "testdata/repo"))
+	h := NewHelm(fetcher, func(ctx context.Context) (map[string]*cluster.Target, error) {
+		return map[string]*cluster.Target{"": target}, nil
+	})
+	h.actionConfig = func(target *cluster.Target, namespace string) (*action.Configuration, error) {
+		return testActionConfig(releases, namespace), nil
+	}
+	return h, target
+}
+
+// testActionConfig returns a Helm configuration storing releases in memory and deploying nothing
+func testActionConfig(releases *driver.Memory, namespace string) *action.Configuration {
+	releases.SetNamespace(namespace)
+	return &action.Configuration{
+		Releases:     storage.Init(releases),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(string, ...interface{}) {},
+	}
+}
+
+func testTenant(greeting string) *v1.Tenant {
+	return &v1.Tenant{
+		Id: "t1",
+		Source: &v1.Source{
+			RepoUrl: testRepoURL,
+			Path:    "chart",
+			Helm: &v1.Helm{Values: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"greeting": structpb.NewStringValue(greeting),
+			}}},
+		},
+	}
+}
+
+func TestHelmEnsure(t *testing.T) {
+	ctx := context.Background()
+	releases := driver.NewMemory()
+	h, target := newTestHelm(t, releases)
+	name := constants.ApplicationNameForTenant("t1")
+	namespace := constants.NamespaceNameForTenant("t1")
+
+	if err := h.Ensure(ctx, name, testTenant("hello"), target); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	// Ensuring the same tenant again leaves the release as it is
+	if err := h.Ensure(ctx, name, testTenant("hello"), target); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if rel := lastRelease(t, releases, namespace); rel.Version != 1 {
+		t.Fatalf("expected a single revision, got %d", rel.Version)
+	}
+	if err := h.Ensure(ctx, name, testTenant("bonjour"), target); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	rel := lastRelease(t, releases, namespace)
+	if rel.Version != 2 {
+		t.Fatalf("expected an upgrade, got revision %d", rel.Version)
+	}
+	if rel.Labels[helmDeploymentLabel] != name {
+		t.Fatalf("expected the release to be labeled with the deployment, got %v", rel.Labels)
+	}
+}
+
+func TestHelmAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	releases := driver.NewMemory()
+	h, target := newTestHelm(t, releases)
+	name := constants.ApplicationNameForTenant("t1")
+	namespace := constants.NamespaceNameForTenant("t1")
+	if err := h.Ensure(ctx, name, testTenant("hello"), target); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+
+	// A new backend only has the releases stored in the cluster
+	restarted, target := newTestHelm(t, releases)
+	app, err := restarted.Observe(ctx, name)
+	if err != nil {
+		t.Fatalf("observe: %v", err)
+	}
+	if app.GetHealth().GetStatus() != "Healthy" {
+		t.Fatalf("expected a healthy release, got %v", app)
+	}
+	resources, err := restarted.Resources(ctx, name)
+	if err != nil {
+		t.Fatalf("resources: %v", err)
+	}
+	if len(resources) != 1 || resources[0].GetName() != "greeting" {
+		t.Fatalf("unexpected resources %v", resources)
+	}
+	if err := restarted.Ensure(ctx, name, testTenant("hello"), target); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if rel := lastRelease(t, releases, namespace); rel.Version != 1 {
+		t.Fatalf("expected the release to be left as it is, got revision %d", rel.Version)
+	}
+
+	if err := restarted.Delete(ctx, name); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	releases.SetNamespace(namespace)
+	if history, _ := storage.Init(releases).History(namespace); len(history) > 0 {
+		t.Fatalf("expected the release to be uninstalled, got %d revisions", len(history))
+	}
+	if app, err := restarted.Observe(ctx, name); err != nil || app != nil {
+		t.Fatalf("expected no application, got %v, %v", app, err)
+	}
+}
+
+func TestHelmEnsureUninstalledOutOfBand(t *testing.T) {
+	ctx := context.Background()
+	releases := driver.NewMemory()
+	h, target := newTestHelm(t, releases)
+	name := constants.ApplicationNameForTenant("t1")
+	namespace := constants.NamespaceNameForTenant("t1")
+	if err := h.Ensure(ctx, name, testTenant("hello"), target); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	releases.SetNamespace(namespace)
+	if _, err := storage.Init(releases).Delete(namespace, 1); err != nil {
+		t.Fatalf("uninstall: %v", err)
+	}
+
+	// The release is installed again although nothing changed in the tenant
+	if err := h.Ensure(ctx, name, testTenant("hello"), target); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if rel := lastRelease(t, releases, namespace); rel.Version != 1 || rel.Info.Status != release.StatusDeployed {
+		t.Fatalf("expected the release to be installed again, got revision %d %s", rel.Version, rel.Info.Status)
+	}
+}
+
+func TestHelmEnsureOnAnotherCluster(t *testing.T) {
+	ctx := context.Background()
+	source := &cluster.Target{ID: "source", Server: "https://source.example.com"}
+	target := &cluster.Target{ID: "target", Server: "https://target.example.com"}
+	releases := map[string]*driver.Memory{
+		source.Server: driver.NewMemory(),
+		target.Server: driver.NewMemory(),
+	}
+	fetcher := charts.NewFetcher(t.TempDir(), charts.WithLocalRepo(testRepoURL, "testdata/repo"))
+	h := NewHelm(fetcher, func(ctx context.Context) (map[string]*cluster.Target, error) {
+		return map[string]*cluster.Target{source.ID: source, target.ID: target}, nil
+	})
+	h.actionConfig = func(target *cluster.Target, namespace string) (*action.Configuration, error) {
+		return testActionConfig(releases[target.Server], namespace), nil
+	}
+	name := constants.ApplicationNameForTenant("t1")
+	namespace := constants.NamespaceNameForTenant("t1")
+	if err := h.Ensure(ctx, name, testTenant("hello"), source); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+
+	if err := h.Ensure(ctx, name, testTenant("hello"), target); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if rel := lastRelease(t, releases[target.Server], namespace); rel.Version != 1 {
+		t.Fatalf("expected the release to be installed on the target, got revision %d", rel.Version)
+	}
+	releases[source.Server].SetNamespace(namespace)
+	if history, _ := storage.Init(releases[source.Server]).History(namespace); len(history) > 0 {
+		t.Fatalf("expected the release to be uninstalled from the source, got %d revisions", len(history))
+	}
+}
+
+func lastRelease(t *testing.T, releases *driver.Memory, namespace string) *release.Release {
+	t.Helper()
+	releases.SetNamespace(namespace)
+	rel, err := storage.Init(releases).Last(namespace)
+	if err != nil {
+		t.Fatalf("get release: %v", err)
+	}
+	return rel
+}
@@ -0,0 +1,22 @@
+package deploy
+
+import (
+	"errors"
+	v1 "poc-cloud-service/gen/api/v1"
+)
+
+var (
+	ErrNotFound            = errors.New("deployment not found")
+	ErrUnsupported         = errors.New("not supported by the gitops backend")
+	ErrOperationInProgress = errors.New("another operation is in progress")
+	ErrNoOperation         = errors.New("no operation is in progress")
+)
+
+// SyncOptions configure a sync triggered with Sync
+type SyncOptions struct {
+	Prune  bool
+	Force  bool
+	DryRun bool
+	// Resources restricts the sync to some resources, all are synced when empty
+	Resources []*v1.SyncResource
+}
@@ -0,0 +1,192 @@
+package deploy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+)
+
+// Change is an object as it is on the cluster and as a deployer would write it.
+// Live is nil for objects to create, Desired is nil for objects to delete.
+type Change struct {
+	Live    *unstructured.Unstructured
+	Desired *unstructured.Unstructured
+}
+
+// TenantNamespaceLabels are the labels the namespace of a tenant needs with a deployer
+func TenantNamespaceLabels(d Deployer, tenantID string) map[string]string {
+	labels := map[string]string{
+		constants.IsTenantLabel: "true",
+		constants.TenantLabel:   tenantID,
+	}
+	for k, v := range d.NamespaceLabels() {
+		labels[k] = v
+	}
+	return labels
+}
+
+// PreviewNamespace returns the change to the namespace of a tenant, labels are added to an existing namespace but never removed
+func PreviewNamespace(ctx context.Context, d Deployer, client kubernetes.Interface, tenantID string, deleting bool) ([]Change, error) {
+	name := constants.NamespaceNameForTenant(tenantID)
+	got, err := client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	var live *unstructured.Unstructured
+	if err == nil {
+		got.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+		if live, err = toUnstructured(got); err != nil {
+			return nil, err
+		}
+	}
+	if deleting {
+		return appendChange(nil, live, nil), nil
+	}
+
+	desired := &unstructured.Unstructured{}
+	desired.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+	desired.SetName(name)
+	labels := map[string]string{}
+	if live != nil {
+		desired = live.DeepCopy()
+		labels = live.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+	}
+	for k, v := range TenantNamespaceLabels(d, tenantID) {
+		labels[k] = v
+	}
+	desired.SetLabels(labels)
+	return appendChange(nil, live, desired), nil
+}
+
+// previewObject returns the change to an object, desired is nil for a deletion
+func previewObject(ctx context.Context, changes []Change, resource dynamic.ResourceInterface, name string, desired *unstructured.Unstructured) ([]Change, error) {
+	live, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		live = nil
+	}
+	if desired != nil {
+		desired = desired.DeepCopy()
+	}
+	redactSecret(live)
+	redactSecret(desired)
+	return appendChange(changes, live, desired), nil
+}
+
+// previewSecretValues returns the change to the secret values Secret of a tenant, deleted when tenant is nil
+func previewSecretValues(ctx context.Context, changes []Change, client kubernetes.Interface, namespace, name string, tenant *v1.Tenant) ([]Change, error) {
+	var live, desired *unstructured.Unstructured
+	got, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get secret values: %w", err)
+	}
+	if err == nil {
+		got.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		if live, err = toUnstructured(got); err != nil {
+			return nil, err
+		}
+		redactSecret(live)
+	}
+
+	if values := tenant.GetSource().GetHelm().GetSecretValues(); len(values.GetFields()) > 0 {
+		data, err := secretValuesData(values)
+		if err != nil {
+			return nil, err
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					constants.IsTenantLabel: "true",
+					constants.TenantLabel:   tenant.GetId(),
+				},
+			},
+			Data: data,
+		}
+		secret.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		if desired, err = toUnstructured(secret); err != nil {
+			return nil, err
+		}
+		redactSecret(desired)
+	}
+	return appendChange(changes, live, desired), nil
+}
+
+// appendChange appends a change unless the object neither exists nor is wanted
+func appendChange(changes []Change, live, desired *unstructured.Unstructured) []Change {
+	if live == nil && desired == nil {
+		return changes
+	}
+	return append(changes, Change{Live: live, Desired: desired})
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: u}, nil
+}
+
+// redactSecret replaces the data of a Secret by keyed digests, which still tell whether it changes. Other objects are left as is.
+func redactSecret(obj *unstructured.Unstructured) {
+	if obj == nil || obj.GroupVersionKind().GroupKind() != corev1.SchemeGroupVersion.WithKind("Secret").GroupKind() {
+		return
+	}
+	if data, ok, _ := unstructured.NestedMap(obj.Object, "data"); ok {
+		for k, v := range data {
+			encoded, _ := v.(string)
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			data[k] = redactedDigest(decoded)
+		}
+		_ = unstructured.SetNestedMap(obj.Object, data, "data")
+	}
+	if stringData, ok, _ := unstructured.NestedMap(obj.Object, "stringData"); ok {
+		for k, v := range stringData {
+			value, _ := v.(string)
+			stringData[k] = redactedDigest([]byte(value))
+		}
+		_ = unstructured.SetNestedMap(obj.Object, stringData, "stringData")
+	}
+}
+
+// redactionKey keys the digests of redacted values. It is generated at startup and never leaves the process, so
+// callers cannot guess low entropy secrets from their digests, which only compare equal within the process.
+var redactionKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate the redaction key: %s", err))
+	}
+	return key
+}()
+
+// redactedDigest is the HMAC of a secret value under redactionKey
+func redactedDigest(data []byte) string {
+	mac := hmac.New(sha256.New, redactionKey)
+	mac.Write(data)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,45 @@
+package deploy
+
+import (
+	"encoding/base64"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"reflect"
+	"testing"
+)
+
+func TestRedactSecret(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "values"},
+		"data":       map[string]interface{}{"password": base64.StdEncoding.EncodeToString([]byte("hunter2"))},
+		"stringData": map[string]interface{}{"token": "hunter2"},
+	}}
+	redactSecret(secret)
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	stringData, _, _ := unstructured.NestedStringMap(secret.Object, "stringData")
+	if data["password"] != redactedDigest([]byte("hunter2")) {
+		t.Errorf("data was not replaced by its digest: %v", data)
+	}
+	// An unkeyed digest could be reversed by hashing guesses
+	if data["password"] == digest([]byte("hunter2")) {
+		t.Errorf("data was replaced by an unkeyed digest: %v", data)
+	}
+	// data and stringData hold the same value, their digests match
+	if stringData["token"] != data["password"] {
+		t.Errorf("stringData was not replaced by its digest: %v", stringData)
+	}
+
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "values"},
+		"data":       map[string]interface{}{"password": "hunter2"},
+	}}
+	want := configMap.DeepCopy()
+	redactSecret(configMap)
+	if !reflect.DeepEqual(configMap, want) {
+		t.Errorf("a ConfigMap was changed: %v", configMap.Object)
+	}
+	redactSecret(nil)
+}
@@ -0,0 +1,80 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/log"
+	"reflect"
+	"sigs.k8s.io/yaml"
+)
+
+// ensureSecretValues writes the secret values of a tenant to a Secret, or deletes the Secret when there are none
+func ensureSecretValues(ctx context.Context, client kubernetes.Interface, namespace, name string, tenant *v1.Tenant) error {
+	l := log.FromContext(ctx).With(zap.String("secret", name))
+	secrets := client.CoreV1().Secrets(namespace)
+
+	values := tenant.GetSource().GetHelm().GetSecretValues()
+	if len(values.GetFields()) == 0 {
+		return deleteSecretValues(ctx, client, namespace, name)
+	}
+
+	data, err := secretValuesData(values)
+	if err != nil {
+		return err
+	}
+	got, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get secret values: %w", err)
+		}
+		l.Info("Creating secret values")
+		if _, err := secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					constants.IsTenantLabel: "true",
+					constants.TenantLabel:   tenant.GetId(),
+				},
+			},
+			Data: data,
+		}, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create secret values: %w", err)
+		}
+		return nil
+	}
+	if reflect.DeepEqual(got.Data, data) {
+		return nil
+	}
+	l.Info("Updating secret values")
+	got.Data = data
+	if _, err := secrets.Update(ctx, got, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret values: %w", err)
+	}
+	return nil
+}
+
+// deleteSecretValues deletes the secret values Secret of a deployment
+func deleteSecretValues(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	err := client.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete secret values: %w", err)
+	}
+	return nil
+}
+
+func secretValuesData(values *structpb.Struct) (map[string][]byte, error) {
+	yamlBytes, err := yaml.Marshal(values.AsMap())
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{constants.SecretValuesKey: yamlBytes}, nil
+}
@@ -0,0 +1,10 @@
+package deploy
+
+import (
+	v1 "poc-cloud-service/gen/api/v1"
+)
+
+// isHelmSource is true for sources rendered as a helm chart, the only kind the flux and helm backends deploy
+func isHelmSource(source *v1.Source) bool {
+	return source.GetType() == v1.SourceType_SOURCE_TYPE_UNSPECIFIED || source.GetType() == v1.SourceType_SOURCE_TYPE_HELM
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"poc-cloud-service/log"
+	"strings"
+	"time"
+)
+
+// checkTimeout bounds each run of a check
+const checkTimeout = 5 * time.Second
+
+// Check reports a problem with a dependency of the service
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Checker runs the liveness and readiness checks of the service
+type Checker struct {
+	liveness  []Check
+	readiness []Check
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// AddLiveness adds a check that fails when the service needs to be restarted
+func (c *Checker) AddLiveness(name string, check func(ctx context.Context) error) {
+	c.liveness = append(c.liveness, Check{Name: name, Check: check})
+}
+
+// AddReadiness adds a check that fails when the service cannot serve requests
+func (c *Checker) AddReadiness(name string, check func(ctx context.Context) error) {
+	c.readiness = append(c.readiness, Check{Name: name, Check: check})
+}
+
+// result is the outcome of a check
+type result struct {
+	Name string
+	Err  error
+}
+
+// run runs checks, all of them passed when ok is set
+func run(ctx context.Context, checks []Check) (results []result, ok bool) {
+	ok = true
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := check.Check(checkCtx)
+		cancel()
+		if err != nil {
+			ok = false
+		}
+		results = append(results, result{Name: check.Name, Err: err})
+	}
+	return results, ok
+}
+
+// Register serves /livez with the liveness checks, /readyz with the readiness checks and /healthz with both
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.Handle("/livez", handler("livez", c.liveness))
+	mux.Handle("/readyz", handler("readyz", c.readiness))
+	mux.Handle("/healthz", handler("healthz", append(append([]Check{}, c.liveness...), c.readiness...)))
+}
+
+// handler runs checks and writes one line per check, with status 503 if any failed
+func handler(name string, checks []Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results, ok := run(r.Context(), checks)
+		var b strings.Builder
+		for _, res := range results {
+			if res.Err != nil {
+				fmt.Fprintf(&b, "[-]%s failed: %s\n", res.Name, res.Err)
+			} else {
+				fmt.Fprintf(&b, "[+]%s ok\n", res.Name)
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if !ok {
+			log.FromContext(r.Context()).Warn("Health check failed", zap.String("endpoint", name), zap.String("checks", b.String()))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(&b, "%s check failed\n", name)
+		} else {
+			fmt.Fprintf(&b, "%s check passed\n", name)
+		}
+		_, _ = w.Write([]byte(b.String()))
+	})
+}
+
+// Watch runs the checks every interval and reports them through the grpc.health.v1 server: services are serving
+// while the readiness checks pass, the overall status also needs the liveness checks to pass
+func (c *Checker) Watch(ctx context.Context, server *health.Server, interval time.Duration, services ...string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, live := run(ctx, c.liveness)
+		_, ready := run(ctx, c.readiness)
+		readyStatus := servingStatus(ready)
+		for _, service := range services {
+			server.SetServingStatus(service, readyStatus)
+		}
+		server.SetServingStatus("", servingStatus(live && ready))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func servingStatus(ok bool) healthpb.HealthCheckResponse_ServingStatus {
+	if ok {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// Heartbeat returns a check that fails once last, the time a loop started at start last made progress,
+// is older than timeout. Zero disables it.
+func Heartbeat(last func() time.Time, start time.Time, timeout time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if timeout == 0 {
+			return nil
+		}
+		at := last()
+		if at.IsZero() {
+			if time.Since(start) > timeout {
+				return fmt.Errorf("no pass since start %s ago", time.Since(start).Round(time.Second))
+			}
+			return nil
+		}
+		if time.Since(at) > timeout {
+			return fmt.Errorf("last pass %s ago", time.Since(at).Round(time.Second))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,33 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+
+	now := time.Now()
+	tests := []struct {
+		name    string
+		last    time.Time
+		start   time.Time
+		timeout time.Duration
+		wantErr bool
+	}{
+		{name: "disabled", start: now.Add(-time.Hour), timeout: 0},
+		{name: "starting", start: now.Add(-time.Second), timeout: time.Minute},
+		{name: "never progressed", start: now.Add(-time.Hour), timeout: time.Minute, wantErr: true},
+		{name: "recent progress", last: now.Add(-time.Second), start: now.Add(-time.Hour), timeout: time.Minute},
+		{name: "stale progress", last: now.Add(-time.Hour), start: now.Add(-2 * time.Hour), timeout: time.Minute, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			check := Heartbeat(func() time.Time { return test.last }, test.start, test.timeout)
+			if err := check(context.Background()); (err != nil) != test.wantErr {
+				t.Errorf("Heartbeat() error = %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
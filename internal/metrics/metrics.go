@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "poc_cloud_service"
+
+// Registry holds the metrics of the service, served on the metrics listener
+var Registry = prometheus.NewRegistry()
+
+// Metrics of the API, the reconciler and the store
+var (
+	GRPCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "gRPC requests by method and status code.",
+	}, []string{"method", "code"})
+	GRPCRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Latency of gRPC requests by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by handler, method and status code.",
+	}, []string{"handler", "method", "code"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by handler and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler", "method"})
+
+	ReconcilePasses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_passes_total",
+		Help:      "Reconciler passes by result, success or error.",
+	}, []string{"result"})
+	ReconcilePassDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_pass_duration_seconds",
+		Help:      "Duration of reconciler passes.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+	ReconcileLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "reconcile_last_success_timestamp_seconds",
+		Help:      "Unix time at which the last successful reconciler pass ended.",
+	})
+	ReconcileQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "reconcile_queue_depth",
+		Help:      "Tenants left to reconcile in the current pass.",
+	})
+	// TenantReconcileDuration is not broken down by tenant, whose detail is in the logs and traces
+	TenantReconcileDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tenant_reconcile_duration_seconds",
+		Help:      "Duration of the reconciliation of a tenant.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	// TenantReconcileErrors has a series per tenant that failed, removed once the tenant is deleted
+	TenantReconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tenant_reconcile_errors_total",
+		Help:      "Failed reconciliations of a tenant.",
+	}, []string{"tenant"})
+
+	Tenants = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tenants",
+		Help:      "Tenants by phase.",
+	}, []string{"phase"})
+	TenantsByHealth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tenants_by_health",
+		Help:      "Tenants by health of their application as reported by the GitOps engine.",
+	}, []string{"health"})
+
+	StoreQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_query_duration_seconds",
+		Help:      "Latency of store queries by query and result, success or error.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"query", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		GRPCRequests,
+		GRPCRequestDuration,
+		HTTPRequests,
+		HTTPRequestDuration,
+		ReconcilePasses,
+		ReconcilePassDuration,
+		ReconcileLastSuccess,
+		ReconcileQueueDepth,
+		TenantReconcileDuration,
+		TenantReconcileErrors,
+		Tenants,
+		TenantsByHealth,
+		StoreQueryDuration,
+	)
+}
+
+// Handler serves the metrics of Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Result is the result label of an operation that returned err
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
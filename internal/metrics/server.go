@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"time"
+)
+
+// UnaryServerInterceptor counts the gRPC requests and observes their latency
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	GRPCRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	GRPCRequestDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// InstrumentHandler counts the HTTP requests served by handler and observes their latency, name labels them
+func InstrumentHandler(name string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"handler": name}
+	return promhttp.InstrumentHandlerCounter(HTTPRequests.MustCurryWith(labels),
+		promhttp.InstrumentHandlerDuration(HTTPRequestDuration.MustCurryWith(labels), handler))
+}
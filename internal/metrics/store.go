@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"poc-cloud-service/internal/store"
+	"time"
+)
+
+// DB observes the latency of the queries run on a store.DBTX
+type DB struct {
+	db store.DBTX
+}
+
+var _ store.DBTX = (*DB)(nil)
+
+// InstrumentDB returns db observing the latency of its queries
+func InstrumentDB(db store.DBTX) *DB {
+	return &DB{db: db}
+}
+
+func (d *DB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	start := time.Now()
+	tag, err := d.db.Exec(ctx, sql, args...)
+	observeQuery(sql, start, err)
+	return tag, err
+}
+
+func (d *DB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	start := time.Now()
+	rows, err := d.db.Query(ctx, sql, args...)
+	observeQuery(sql, start, err)
+	return rows, err
+}
+
+func (d *DB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return &row{Row: d.db.QueryRow(ctx, sql, args...), sql: sql, start: time.Now()}
+}
+
+// row observes a QueryRow once it is scanned, which is when the query runs
+type row struct {
+	pgx.Row
+	sql   string
+	start time.Time
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if err == pgx.ErrNoRows {
+		observeQuery(r.sql, r.start, nil)
+	} else {
+		observeQuery(r.sql, r.start, err)
+	}
+	return err
+}
+
+func observeQuery(sql string, start time.Time, err error) {
+	StoreQueryDuration.WithLabelValues(store.QueryName(sql), Result(err)).Observe(time.Since(start).Seconds())
+}
+
+// poolCollector exports the statistics of a pgx pool
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns       *prometheus.Desc
+	idleConns           *prometheus.Desc
+	totalConns          *prometheus.Desc
+	maxConns            *prometheus.Desc
+	acquires            *prometheus.Desc
+	acquireDuration     *prometheus.Desc
+	emptyAcquires       *prometheus.Desc
+	canceledAcquires    *prometheus.Desc
+	newConns            *prometheus.Desc
+	maxLifetimeDestroys *prometheus.Desc
+	maxIdleDestroys     *prometheus.Desc
+}
+
+// RegisterPool exports the statistics of pool on Registry
+func RegisterPool(pool *pgxpool.Pool) error {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pgx_pool", name), help, nil, nil)
+	}
+	return Registry.Register(&poolCollector{
+		pool:                pool,
+		acquiredConns:       desc("acquired_conns", "Connections currently acquired from the pool."),
+		idleConns:           desc("idle_conns", "Idle connections in the pool."),
+		totalConns:          desc("total_conns", "Connections in the pool."),
+		maxConns:            desc("max_conns", "Maximum size of the pool."),
+		acquires:            desc("acquires_total", "Successful acquires from the pool."),
+		acquireDuration:     desc("acquire_duration_seconds_total", "Time spent acquiring connections from the pool."),
+		emptyAcquires:       desc("empty_acquires_total", "Acquires that waited for a connection because the pool was empty."),
+		canceledAcquires:    desc("canceled_acquires_total", "Acquires canceled by their context."),
+		newConns:            desc("new_conns_total", "Connections opened by the pool."),
+		maxLifetimeDestroys: desc("max_lifetime_destroys_total", "Connections closed for exceeding their maximum lifetime."),
+		maxIdleDestroys:     desc("max_idle_destroys_total", "Connections closed for exceeding their maximum idle time."),
+	})
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.newConns, prometheus.CounterValue, float64(stat.NewConnsCount()))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeDestroys, prometheus.CounterValue, float64(stat.MaxLifetimeDestroyCount()))
+	ch <- prometheus.MustNewConstMetric(c.maxIdleDestroys, prometheus.CounterValue, float64(stat.MaxIdleDestroyCount()))
+}
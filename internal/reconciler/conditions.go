@@ -0,0 +1,217 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/metrics"
+	"poc-cloud-service/internal/store"
+	"poc-cloud-service/log"
+)
+
+// Types of the conditions of tenants
+const (
+	ConditionNamespaceReady   = "NamespaceReady"
+	ConditionApplicationReady = "ApplicationReady"
+	ConditionHealthy          = "Healthy"
+	ConditionSynced           = "Synced"
+)
+
+// Reasons of the conditions of tenants, Healthy and Synced take the status reported by the deployer
+const (
+	ReasonEnsured       = "Ensured"
+	ReasonEnsureFailed  = "EnsureFailed"
+	ReasonNotObserved   = "NotObserved"
+	ReasonObserveFailed = "ObserveFailed"
+	// ReasonClusterUnavailable is set when the cluster of a tenant is not registered or cannot be reached
+	ReasonClusterUnavailable = "ClusterUnavailable"
+	// ReasonInvalidTenant is set when the stored tenant cannot be read, like secret values that fail to decrypt
+	ReasonInvalidTenant = "InvalidTenant"
+)
+
+// reconcileTenant ensures the namespace and the application of a tenant and updates its conditions.
+// Each condition that changes is also recorded as an Event on the tenant namespace.
+func (r *Reconciler) reconcileTenant(ctx context.Context, tenant *v1.Tenant, storedTenant store.Tenant, target *cluster.Target) error {
+	var conditions []metav1.Condition
+	if err := json.Unmarshal(storedTenant.Conditions, &conditions); err != nil {
+		return fmt.Errorf("failed to decode conditions: %w", err)
+	}
+	recorder := r.recorder(target.Client)
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: constants.NamespaceNameForTenant(tenant.GetId())}}
+	changed := false
+	setCondition := func(condition metav1.Condition) {
+		if !meta.SetStatusCondition(&conditions, condition) {
+			return
+		}
+		changed = true
+		eventType := corev1.EventTypeNormal
+		if condition.Status != metav1.ConditionTrue {
+			eventType = corev1.EventTypeWarning
+		}
+		recorder.Eventf(namespace, eventType, condition.Reason, "%s is %s: %s", condition.Type, condition.Status, condition.Message)
+	}
+
+	err := r.reconcileTenantResources(ctx, tenant, storedTenant, target, namespace, setCondition)
+	if err != nil {
+		recorder.Event(namespace, corev1.EventTypeWarning, ReasonReconcileFailed, err.Error())
+	}
+	if changed {
+		r.storeConditions(ctx, tenant.GetId(), conditions)
+	}
+	return err
+}
+
+// reportSkipped marks the namespace and the application of a tenant as failed for reason when it is not reconciled,
+// the tenant namespace is not reached to record an Event
+func (r *Reconciler) reportSkipped(ctx context.Context, storedTenant store.Tenant, reason string, cause error) error {
+	var conditions []metav1.Condition
+	if err := json.Unmarshal(storedTenant.Conditions, &conditions); err != nil {
+		return fmt.Errorf("failed to decode conditions: %w", err)
+	}
+	changed := false
+	for _, conditionType := range []string{ConditionNamespaceReady, ConditionApplicationReady} {
+		if meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:    conditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: cause.Error(),
+		}) {
+			changed = true
+		}
+	}
+	if changed {
+		r.storeConditions(ctx, storedTenant.ID, conditions)
+	}
+	return nil
+}
+
+// storeConditions persists the conditions of a tenant, a failure is only logged as the next pass sets them again
+func (r *Reconciler) storeConditions(ctx context.Context, tenantID string, conditions []metav1.Condition) {
+	conditionsJson, err := json.Marshal(conditions)
+	if err == nil {
+		_, err = r.store.SetTenantConditions(ctx, store.SetTenantConditionsParams{
+			ID:         tenantID,
+			Conditions: conditionsJson,
+		})
+	}
+	if err != nil {
+		log.FromContext(ctx).Error("Failed to store conditions", zap.Error(err))
+	}
+}
+
+// reconcileTenantResources ensures the resources of a tenant, reporting their conditions to setCondition.
+// namespace is updated with the tenant namespace once it is ensured.
+func (r *Reconciler) reconcileTenantResources(ctx context.Context, tenant *v1.Tenant, storedTenant store.Tenant, target *cluster.Target, namespace *corev1.Namespace, setCondition func(metav1.Condition)) error {
+	ensured, err := r.ensureTenantNamespace(r.withDriftRecorder(ctx, tenant.GetId(), target.Client), target.Client, tenant)
+	setCondition(ensuredCondition(ConditionNamespaceReady, "Namespace", err))
+	if err != nil {
+		return fmt.Errorf("failed to ensure tenant namespace: %w", err)
+	}
+	*namespace = *ensured
+
+	// Deployments live on the cluster of the service
+	appName := constants.ApplicationNameForTenant(tenant.GetId())
+	err = r.deployer.Ensure(r.withDriftRecorder(ctx, tenant.GetId(), r.client), appName, tenant, target)
+	setCondition(ensuredCondition(ConditionApplicationReady, "Application", err))
+	if err != nil {
+		return fmt.Errorf("failed to ensure tenant application: %w", err)
+	}
+
+	app, err := r.deployer.Observe(ctx, appName)
+	if err != nil {
+		log.FromContext(ctx).Error("Failed to observe tenant application", zap.Error(err))
+		message := fmt.Sprintf("Failed to observe the application: %s", err)
+		setCondition(metav1.Condition{Type: ConditionHealthy, Status: metav1.ConditionUnknown, Reason: ReasonObserveFailed, Message: message})
+		setCondition(metav1.Condition{Type: ConditionSynced, Status: metav1.ConditionUnknown, Reason: ReasonObserveFailed, Message: message})
+	} else {
+		setCondition(observedCondition(ConditionHealthy, "Healthy", app.GetHealth().GetStatus(), app.GetHealth().GetMessage()))
+		setCondition(observedCondition(ConditionSynced, "Synced", app.GetSync().GetStatus(), app.GetSync().GetRevision()))
+	}
+
+	if err := r.reconcileSuspension(ctx, target.Client, storedTenant); err != nil {
+		return fmt.Errorf("failed to reconcile tenant suspension: %w", err)
+	}
+	return nil
+}
+
+// ensuredCondition returns the condition of an object the reconciler ensures, err being the result of ensuring it
+func ensuredCondition(conditionType, kind string, err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{Type: conditionType, Status: metav1.ConditionFalse, Reason: ReasonEnsureFailed, Message: err.Error()}
+	}
+	return metav1.Condition{Type: conditionType, Status: metav1.ConditionTrue, Reason: ReasonEnsured, Message: kind + " is up to date"}
+}
+
+// observedCondition returns the condition of a status reported by the deployer, true when it is want.
+// A status that is not reported, or reported as Unknown, is unknown.
+func observedCondition(conditionType, want, status, message string) metav1.Condition {
+	switch status {
+	case "", "Unknown":
+		return metav1.Condition{Type: conditionType, Status: metav1.ConditionUnknown, Reason: ReasonNotObserved, Message: message}
+	case want:
+		return metav1.Condition{Type: conditionType, Status: metav1.ConditionTrue, Reason: status, Message: message}
+	}
+	return metav1.Condition{Type: conditionType, Status: metav1.ConditionFalse, Reason: status, Message: message}
+}
+
+// Phases of tenants, derived from their conditions
+const (
+	PhaseSuspended   = "Suspended"
+	PhaseMoving      = "Moving"
+	PhaseFailed      = "Failed"
+	PhaseReady       = "Ready"
+	PhaseProgressing = "Progressing"
+)
+
+// tenantPhase summarizes the state of a tenant, moving being whether an operation moves it to another cluster
+func tenantPhase(storedTenant store.Tenant, conditions []metav1.Condition, moving bool) string {
+	switch {
+	case storedTenant.Suspended:
+		return PhaseSuspended
+	case moving:
+		return PhaseMoving
+	case meta.IsStatusConditionFalse(conditions, ConditionNamespaceReady), meta.IsStatusConditionFalse(conditions, ConditionApplicationReady):
+		return PhaseFailed
+	case meta.IsStatusConditionTrue(conditions, ConditionHealthy) && meta.IsStatusConditionTrue(conditions, ConditionSynced):
+		return PhaseReady
+	}
+	return PhaseProgressing
+}
+
+// observeTenants counts the tenants by phase and by health, as of the conditions of the previous pass
+func observeTenants(storedTenants []store.Tenant, operations []store.Operation) error {
+	moving := map[string]bool{}
+	for _, operation := range operations {
+		moving[operation.TenantID] = true
+	}
+	phases := map[string]int{}
+	healths := map[string]int{}
+	for _, storedTenant := range storedTenants {
+		var conditions []metav1.Condition
+		if err := json.Unmarshal(storedTenant.Conditions, &conditions); err != nil {
+			return fmt.Errorf("failed to decode conditions of tenant %s: %w", storedTenant.ID, err)
+		}
+		phases[tenantPhase(storedTenant, conditions, moving[storedTenant.ID])]++
+		health := "Unknown"
+		if healthy := meta.FindStatusCondition(conditions, ConditionHealthy); healthy != nil && healthy.Status != metav1.ConditionUnknown {
+			health = healthy.Reason
+		}
+		healths[health]++
+	}
+	metrics.Tenants.Reset()
+	for phase, count := range phases {
+		metrics.Tenants.WithLabelValues(phase).Set(float64(count))
+	}
+	metrics.TenantsByHealth.Reset()
+	for health, count := range healths {
+		metrics.TenantsByHealth.WithLabelValues(health).Set(float64(count))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"math"
+	"poc-cloud-service/internal/convert"
+	"poc-cloud-service/internal/deploy"
+	"poc-cloud-service/internal/store"
+	"poc-cloud-service/log"
+	"time"
+)
+
+// What the reconciler does with tenant objects changed out of band
+const (
+	DriftModeCorrect = "correct"
+	DriftModeReport  = "report"
+)
+
+// eventPruneInterval is how often tenant events past their retention are deleted
+const eventPruneInterval = 10 * time.Minute
+
+// Reasons of drift events
+const (
+	ReasonDriftCorrected = "DriftCorrected"
+	ReasonDriftDetected  = "DriftDetected"
+)
+
+// withDriftRecorder returns a context under which the drifts of the objects of a tenant are recorded,
+// client being the cluster the objects live on
+func (r *Reconciler) withDriftRecorder(ctx context.Context, tenantID string, client kubernetes.Interface) context.Context {
+	return deploy.WithDriftRecorder(ctx, func(ctx context.Context, drift deploy.Drift) error {
+		return r.recordDrift(ctx, tenantID, client, drift)
+	}, r.options.DriftMode == DriftModeReport)
+}
+
+// recordDrift records a drift as a tenant event and a Kubernetes Event on the drifted object.
+// A drift left in place is only recorded once.
+func (r *Reconciler) recordDrift(ctx context.Context, tenantID string, client kubernetes.Interface, drift deploy.Drift) error {
+	l := log.FromContext(ctx).With(zap.String("kind", drift.Kind), zap.String("name", drift.Name))
+	key := drift.Kind + "/" + drift.Namespace + "/" + drift.Name
+	if drift.Corrected {
+		delete(r.reportedDrifts, key)
+	} else if r.reportedDrifts[key] == drift.Digest {
+		return nil
+	}
+
+	reason, message := ReasonDriftCorrected, fmt.Sprintf("%s %s was changed out of band, %d fields were restored", drift.Kind, drift.Name, len(drift.Fields))
+	if !drift.Corrected {
+		reason, message = ReasonDriftDetected, fmt.Sprintf("%s %s was changed out of band, %d fields differ", drift.Kind, drift.Name, len(drift.Fields))
+	}
+	fieldsJson, err := convert.FieldDiffsToStore(drift.Fields)
+	if err != nil {
+		return err
+	}
+	storedEvent, err := r.store.CreateTenantEvent(ctx, store.CreateTenantEventParams{
+		ID:         xid.New().String(),
+		TenantID:   tenantID,
+		Reason:     reason,
+		Message:    message,
+		ApiVersion: drift.APIVersion,
+		Kind:       drift.Kind,
+		Namespace:  drift.Namespace,
+		Name:       drift.Name,
+		Fields:     fieldsJson,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store drift event: %w", err)
+	}
+	event, err := convert.TenantEventFromStore(storedEvent)
+	if err != nil {
+		return err
+	}
+	lastDriftJson, err := convert.LastDriftToStore(event)
+	if err != nil {
+		return err
+	}
+	if _, err := r.store.RecordTenantDrift(ctx, store.RecordTenantDriftParams{
+		ID:        tenantID,
+		LastDrift: lastDriftJson,
+	}); err != nil {
+		return fmt.Errorf("failed to record drift: %w", err)
+	}
+	if !drift.Corrected {
+		r.reportedDrifts[key] = drift.Digest
+	}
+	l.Info("Drift found", zap.String("reason", reason), zap.Int("fields", len(drift.Fields)))
+
+	r.recorder(client).Event(&corev1.ObjectReference{
+		APIVersion: drift.APIVersion,
+		Kind:       drift.Kind,
+		Namespace:  drift.Namespace,
+		Name:       drift.Name,
+		UID:        drift.UID,
+	}, corev1.EventTypeWarning, reason, message)
+	return nil
+}
+
+// pruneTenantEvents deletes the tenant events older than the retention, above the limit per tenant or of deleted
+// tenants, at most every eventPruneInterval
+func (r *Reconciler) pruneTenantEvents(ctx context.Context) {
+	if time.Since(r.lastEventPrune) < eventPruneInterval {
+		return
+	}
+	r.lastEventPrune = time.Now()
+	params := store.PruneTenantEventsParams{Position: math.MaxInt64}
+	if r.options.EventRetention > 0 {
+		params.CreatedAt = pgtype.Timestamptz{Time: time.Now().Add(-r.options.EventRetention), Valid: true}
+	}
+	if r.options.MaxTenantEvents > 0 {
+		params.Position = int64(r.options.MaxTenantEvents)
+	}
+	deleted, err := r.store.PruneTenantEvents(ctx, params)
+	if err != nil {
+		log.FromContext(ctx).Error("Failed to prune tenant events", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		log.FromContext(ctx).Info("Pruned tenant events", zap.Int64("count", deleted))
+	}
+}
@@ -0,0 +1,38 @@
+package reconciler
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventComponent is the source of the Kubernetes Events of the reconciler
+const eventComponent = "poc-cloud-service"
+
+// Reasons of the Events on tenant namespaces
+const (
+	ReasonReconcileFailed = "ReconcileFailed"
+	ReasonDeleting        = "Deleting"
+)
+
+// recorder returns the EventRecorder writing Events to the cluster of client, each cluster gets its own broadcaster
+func (r *Reconciler) recorder(client kubernetes.Interface) record.EventRecorder {
+	if recorder, ok := r.recorders[client]; ok {
+		return recorder
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+	r.broadcasters = append(r.broadcasters, broadcaster)
+	r.recorders[client] = recorder
+	return recorder
+}
+
+// shutdownRecorders stops the broadcasters once their pending Events are written
+func (r *Reconciler) shutdownRecorders() {
+	for _, broadcaster := range r.broadcasters {
+		broadcaster.Shutdown()
+	}
+}
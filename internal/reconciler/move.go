@@ -0,0 +1,131 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/store"
+	"poc-cloud-service/log"
+	"time"
+)
+
+const healthyStatus = "Healthy"
+
+// reconcileOperations advances each in-progress operation by one step
+func (r *Reconciler) reconcileOperations(ctx context.Context, targets map[string]*cluster.Target, want []*v1.Tenant, invalid map[string]invalidTenant, operations []store.Operation) error {
+	tenants := make(map[string]*v1.Tenant, len(want))
+	for _, tenant := range want {
+		tenants[tenant.GetId()] = tenant
+	}
+	for _, operation := range operations {
+		// The operations of tenants that cannot be read wait for them, they are not deleted
+		if _, ok := invalid[operation.TenantID]; ok || operation.Type != constants.OperationTypeMove {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		operationCtx := log.WithTenant(context.WithoutCancel(ctx), operation.TenantID)
+		if err := r.reconcileMove(operationCtx, targets, tenants[operation.TenantID], operation); err != nil {
+			return fmt.Errorf("failed to reconcile operation %s: %w", operation.ID, err)
+		}
+	}
+	return nil
+}
+
+// reconcileMove moves a tenant to another cluster.
+// The target is provisioned next to the source, and the placement only switches
+// once the target application is healthy. If it is not healthy before the
+// deadline, the target is torn down and the tenant stays where it was.
+func (r *Reconciler) reconcileMove(ctx context.Context, targets map[string]*cluster.Target, tenant *v1.Tenant, operation store.Operation) error {
+	if tenant == nil {
+		return r.setOperationState(ctx, operation, v1.OperationState_OPERATION_STATE_FAILED, "tenant was deleted")
+	}
+
+	target, ok := targets[operation.TargetClusterID]
+	if !ok {
+		return fmt.Errorf("target cluster %s is not available", operation.TargetClusterID)
+	}
+	moveAppName := constants.MoveApplicationNameForTenant(operation.TenantID)
+
+	switch operation.State {
+	case v1.OperationState_OPERATION_STATE_PROVISIONING.String():
+		if _, err := r.ensureTenantNamespace(ctx, target.Client, tenant); err != nil {
+			return fmt.Errorf("failed to ensure target namespace: %w", err)
+		}
+		if err := r.deployer.Ensure(ctx, moveAppName, tenant, target); err != nil {
+			return fmt.Errorf("failed to ensure target application: %w", err)
+		}
+		return r.setOperationState(ctx, operation, v1.OperationState_OPERATION_STATE_WAITING, "waiting for the target application to become healthy")
+
+	case v1.OperationState_OPERATION_STATE_WAITING.String():
+		app, err := r.deployer.Observe(ctx, moveAppName)
+		if err != nil {
+			return err
+		}
+		health := app.GetHealth()
+		if health.GetStatus() == healthyStatus {
+			if _, err := r.store.UpdateTenantCluster(ctx, store.UpdateTenantClusterParams{
+				ID:        operation.TenantID,
+				ClusterID: operation.TargetClusterID,
+			}); err != nil {
+				return fmt.Errorf("failed to switch tenant placement: %w", err)
+			}
+			// The tenant application takes over the target before the move application is released
+			tenant.ClusterId = operation.TargetClusterID
+			if err := r.deployer.Ensure(ctx, constants.ApplicationNameForTenant(tenant.GetId()), tenant, target); err != nil {
+				return fmt.Errorf("failed to point tenant application to the target: %w", err)
+			}
+			if err := r.deployer.Release(ctx, moveAppName); err != nil {
+				return err
+			}
+			return r.setOperationState(ctx, operation, v1.OperationState_OPERATION_STATE_CLEANING_UP, "tearing down the source")
+		}
+		if time.Now().After(operation.Deadline.Time) {
+			return r.setOperationState(ctx, operation, v1.OperationState_OPERATION_STATE_ROLLING_BACK,
+				fmt.Sprintf("target did not become healthy before the deadline: %s %s", health.GetStatus(), health.GetMessage()))
+		}
+		return nil
+
+	case v1.OperationState_OPERATION_STATE_CLEANING_UP.String():
+		source, ok := targets[operation.SourceClusterID]
+		if !ok {
+			return fmt.Errorf("source cluster %s is not available", operation.SourceClusterID)
+		}
+		if source.Server != target.Server {
+			if err := deleteTenantNamespace(ctx, source.Client, operation.TenantID); err != nil {
+				return fmt.Errorf("failed to delete source namespace: %w", err)
+			}
+		}
+		return r.setOperationState(ctx, operation, v1.OperationState_OPERATION_STATE_SUCCEEDED, "tenant moved")
+
+	case v1.OperationState_OPERATION_STATE_ROLLING_BACK.String():
+		if err := r.deployer.Delete(ctx, moveAppName); err != nil {
+			return err
+		}
+		if source, ok := targets[operation.SourceClusterID]; !ok || source.Server != target.Server {
+			if err := deleteTenantNamespace(ctx, target.Client, operation.TenantID); err != nil {
+				return fmt.Errorf("failed to delete target namespace: %w", err)
+			}
+		}
+		return r.setOperationState(ctx, operation, v1.OperationState_OPERATION_STATE_FAILED, operation.Message)
+	}
+
+	return nil
+}
+
+func (r *Reconciler) setOperationState(ctx context.Context, operation store.Operation, state v1.OperationState, message string) error {
+	l := log.FromContext(ctx)
+	l.Info("Operation state changed", zap.String("operation", operation.ID), zap.String("state", state.String()), zap.String("message", message))
+	if _, err := r.store.UpdateOperationState(ctx, store.UpdateOperationStateParams{
+		ID:      operation.ID,
+		State:   state.String(),
+		Message: message,
+	}); err != nil {
+		return fmt.Errorf("failed to update operation state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/log"
+	"time"
+)
+
+// What the reconciler does with tenant namespaces that have no tenant
+const (
+	OrphanPolicyDelete = "delete"
+	OrphanPolicyRetain = "retain"
+	OrphanPolicyReport = "report"
+)
+
+// ReasonOrphaned is the reason of the Events on orphaned namespaces that are reported only
+const ReasonOrphaned = "Orphaned"
+
+// orphan is a managed tenant namespace whose tenant is not in the desired state
+type orphan struct {
+	existingTenant
+	target *cluster.Target
+}
+
+// reconcileOrphans applies the orphan policy to the orphaned namespaces of a pass, out of managed tenant namespaces.
+// A pass finding too many orphans deletes none, a database that lost its tenants would otherwise wipe every cluster.
+func (r *Reconciler) reconcileOrphans(ctx context.Context, orphans []orphan, managed int) error {
+	l := log.FromContext(ctx)
+
+	var candidates []orphan
+	for _, o := range orphans {
+		if o.namespace.Annotations[constants.ProtectedAnnotation] == "true" {
+			log.FromContext(log.WithTenant(ctx, o.id)).Info("Keeping protected namespace", zap.String("server", o.target.Server))
+			continue
+		}
+		candidates = append(candidates, o)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch r.options.OrphanPolicy {
+	case OrphanPolicyRetain:
+		return nil
+	case OrphanPolicyReport:
+		for _, o := range candidates {
+			r.reportOrphan(ctx, o)
+		}
+		return nil
+	}
+
+	if limit := r.options.MaxOrphanDeletions; limit > 0 && len(candidates) > limit {
+		l.Error("Refusing to delete orphaned tenants, too many are orphaned", zap.Int("orphans", len(candidates)), zap.Int("max", limit))
+		return nil
+	}
+	// A single orphan is exempt from the percentage, tenants of small deployments could not be deleted otherwise
+	if percent := r.options.MaxOrphanDeletionPercent; percent > 0 && len(candidates) > 1 && len(candidates)*100 > managed*percent {
+		l.Error("Refusing to delete orphaned tenants, too many are orphaned", zap.Int("orphans", len(candidates)), zap.Int("managed", managed), zap.Int("maxPercent", percent))
+		return nil
+	}
+
+	now := time.Now()
+	for _, o := range candidates {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tenantCtx := log.WithTenant(context.WithoutCancel(ctx), o.id)
+		orphanedAt, err := r.orphanedAt(tenantCtx, o, now)
+		if err != nil {
+			return err
+		}
+		if remaining := orphanedAt.Add(r.options.OrphanGracePeriod).Sub(now); remaining > 0 {
+			log.FromContext(tenantCtx).Info("Orphaned tenant in grace period", zap.Duration("remaining", remaining))
+			continue
+		}
+		// Delete tenants that are not in the desired state
+		if err := r.deleteTenant(tenantCtx, o.target.Client, o.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orphanedAt returns when a namespace was found orphaned, recording now on the namespace the first time
+func (r *Reconciler) orphanedAt(ctx context.Context, o orphan, now time.Time) (time.Time, error) {
+	if value, ok := o.namespace.Annotations[constants.OrphanedAtAnnotation]; ok {
+		orphanedAt, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return orphanedAt, nil
+		}
+		log.FromContext(ctx).Info("Resetting invalid orphaned at annotation", zap.String("value", value))
+	}
+	if r.options.OrphanGracePeriod <= 0 {
+		return now, nil
+	}
+	log.FromContext(ctx).Info("Tenant namespace orphaned", zap.String("server", o.target.Server))
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, constants.OrphanedAtAnnotation, now.UTC().Format(time.RFC3339))
+	if _, err := o.target.Client.CoreV1().Namespaces().Patch(ctx, o.namespace.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return time.Time{}, fmt.Errorf("failed to mark namespace orphaned: %w", err)
+	}
+	return now, nil
+}
+
+// reportOrphan logs an orphaned namespace and records an Event on it, once per namespace
+func (r *Reconciler) reportOrphan(ctx context.Context, o orphan) {
+	key := o.target.Server + "/" + o.namespace.Name
+	if r.reportedOrphans[key] {
+		return
+	}
+	r.reportedOrphans[key] = true
+	l := log.FromContext(log.WithTenant(ctx, o.id))
+	l.Info("Tenant namespace orphaned, leaving it in place", zap.String("server", o.target.Server))
+	r.recorder(o.target.Client).Eventf(&o.namespace, corev1.EventTypeWarning, ReasonOrphaned, "Namespace %s has no tenant", o.namespace.Name)
+}
@@ -2,112 +2,277 @@ package reconciler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/cluster"
 	"poc-cloud-service/internal/constants"
 	"poc-cloud-service/internal/convert"
+	"poc-cloud-service/internal/deploy"
+	"poc-cloud-service/internal/metrics"
+	"poc-cloud-service/internal/secrets"
 	"poc-cloud-service/internal/store"
+	"poc-cloud-service/internal/tracing"
 	"poc-cloud-service/log"
-	"reflect"
-	"sigs.k8s.io/yaml"
+	"sync/atomic"
 	"time"
 )
 
-const (
-	isTenantLabel            = "is-tenant"
-	tenantLabel              = "tenant"
-	argoCdManagedBy          = "argocd.argoproj.io/managed-by"
-	managedByOpenshiftGitops = "openshift-gitops"
-	defaultRepoURL           = "https://github.com/ludydoo/poc-cloud-service-manifests"
-	defaultRepoPath          = "tenant-manifests"
-)
-
 type Reconciler struct {
-	client        kubernetes.Interface
-	dynamicClient dynamic.Interface
-	store         *store.Queries
+	client   kubernetes.Interface
+	deployer deploy.Deployer
+	store    *store.Queries
+	clusters *cluster.Registry
+	secrets  *secrets.Envelope
+	options  Options
+	// reportedDrifts are the digests of the drifts left in place, by object
+	reportedDrifts map[string]string
+	// reportedOrphans are the orphaned namespaces already reported, by server and name
+	reportedOrphans map[string]bool
+	// recorders write the Kubernetes Events of the reconciler, by cluster client
+	recorders    map[kubernetes.Interface]record.EventRecorder
+	broadcasters []record.EventBroadcaster
+	// lastProgress is when the last pass started or ended, successful or not, in Unix nanoseconds
+	lastProgress atomic.Int64
+	// lastEventPrune is when tenant events were last pruned
+	lastEventPrune time.Time
+	// erroredTenants are the tenants with a reconcile error series
+	erroredTenants map[string]bool
 }
 
-func NewReconciler(client kubernetes.Interface, dynamicClient dynamic.Interface, store *store.Queries) *Reconciler {
+// Options configure the reconciler
+type Options struct {
+	// DriftMode is DriftModeCorrect or DriftModeReport
+	DriftMode string
+	// OrphanPolicy is what happens to tenant namespaces without tenant, OrphanPolicyDelete, OrphanPolicyRetain or OrphanPolicyReport
+	OrphanPolicy string
+	// OrphanGracePeriod is how long an orphaned namespace is kept before it is deleted
+	OrphanGracePeriod time.Duration
+	// MaxOrphanDeletions and MaxOrphanDeletionPercent stop a pass from deleting orphans when more than that many,
+	// or more than one and that percentage of the managed tenant namespaces, are orphaned. Zero disables a limit.
+	MaxOrphanDeletions       int
+	MaxOrphanDeletionPercent int
+	// EventRetention is how long tenant events are kept, MaxTenantEvents how many are kept per tenant.
+	// Zero keeps them all.
+	EventRetention  time.Duration
+	MaxTenantEvents int
+}
+
+func NewReconciler(client kubernetes.Interface, deployer deploy.Deployer, store *store.Queries, clusters *cluster.Registry, secrets *secrets.Envelope, options Options) *Reconciler {
 	return &Reconciler{
-		client:        client,
-		dynamicClient: dynamicClient,
-		store:         store,
+		client:          client,
+		deployer:        deployer,
+		store:           store,
+		clusters:        clusters,
+		secrets:         secrets,
+		options:         options,
+		reportedDrifts:  map[string]string{},
+		reportedOrphans: map[string]bool{},
+		recorders:       map[kubernetes.Interface]record.EventRecorder{},
+		erroredTenants:  map[string]bool{},
 	}
 }
 
+// Start reconciles tenants until ctx is canceled. The tenant being reconciled then is finished before it returns.
 func (r *Reconciler) Start(ctx context.Context) {
 
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 	l := log.FromContext(ctx)
+	defer r.shutdownRecorders()
 
-	go func() {
-		for range ticker.C {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				l.Info("Reconciling tenants")
-				if err := r.reconcileTenants(ctx); err != nil {
-					l.Error("Error reconciling tenants", zap.Error(err))
-				}
+	for {
+		select {
+		case <-ctx.Done():
+			l.Info("Shutting down")
+			return
+		case <-ticker.C:
+			l.Info("Reconciling tenants")
+			start := time.Now()
+			r.lastProgress.Store(start.UnixNano())
+			passCtx, span := tracing.Tracer.Start(ctx, "reconcile")
+			err := r.reconcileTenants(passCtx)
+			tracing.End(span, err)
+			r.lastProgress.Store(time.Now().UnixNano())
+			if ctx.Err() != nil {
+				// The pass was cut short by the shutdown
+				continue
 			}
+			metrics.ReconcilePasses.WithLabelValues(metrics.Result(err)).Inc()
+			metrics.ReconcilePassDuration.Observe(time.Since(start).Seconds())
+			if err != nil {
+				l.Error("Error reconciling tenants", zap.Error(err))
+			} else {
+				metrics.ReconcileLastSuccess.SetToCurrentTime()
+			}
+			r.pruneTenantEvents(ctx)
 		}
-	}()
+	}
+}
 
-	<-ctx.Done()
-	l.Info("Shutting down")
+// LastProgress returns when the last pass started or ended, whatever its result, zero before the first one.
+// Failed passes are reported by the reconcile metrics instead.
+func (r *Reconciler) LastProgress() time.Time {
+	nanos := r.lastProgress.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
 }
 
 func (r *Reconciler) reconcileTenants(ctx context.Context) error {
 
+	// Deployments live on the cluster of the service, so do their Events
+	ctx = deploy.WithEventRecorder(ctx, r.recorder(r.client))
+
 	// Want is the desired state
-	want, err := r.getWant(ctx)
+	want, storedTenants, invalid, err := r.getWant(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get desired state: %w", err)
 	}
 
-	// Create/Update tenants
-	for _, tenant := range want {
-		tenantCtx := log.WithTenant(ctx, tenant.GetId())
-		if err := r.ensureTenantNamespace(tenantCtx, tenant); err != nil {
-			return fmt.Errorf("failed to ensure tenant namespace: %w", err)
-		}
-		if err := r.ensureTenantApplication(tenantCtx, tenant); err != nil {
-			return fmt.Errorf("failed to ensure tenant application: %w", err)
-		}
+	targets, err := r.clusters.Targets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get clusters: %w", err)
 	}
 
-	// Existing is the current state
-	existing, err := r.getExistingTenantIDs(ctx)
+	operations, err := r.store.ListOperationsByState(ctx, constants.ActiveOperationStates)
 	if err != nil {
+		return fmt.Errorf("failed to get operations: %w", err)
+	}
+
+	observed := storedTenants
+	for _, tenant := range invalid {
+		observed = append(observed, tenant.stored)
+	}
+	if err := observeTenants(observed, operations); err != nil {
 		return err
 	}
+	r.forgetDeletedTenants(observed)
+
+	// Create/Update tenants, a tenant that fails does not hold back the others
+	var errs []error
+	wantServers := map[string]map[string]bool{}
+	// unplaced are the tenants whose cluster is not available or that cannot be read,
+	// their namespaces are left alone wherever they are found
+	unplaced := map[string]bool{}
+	for _, tenant := range invalid {
+		tenantCtx := log.WithTenant(ctx, tenant.stored.ID)
+		log.FromContext(tenantCtx).Error("Skipping tenant", zap.Error(tenant.err))
+		unplaced[tenant.stored.ID] = true
+		r.countTenantError(tenant.stored.ID)
+		errs = append(errs, tenant.err)
+		if err := r.reportSkipped(tenantCtx, tenant.stored, ReasonInvalidTenant, tenant.err); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	metrics.ReconcileQueueDepth.Set(float64(len(want)))
+	defer metrics.ReconcileQueueDepth.Set(0)
+	for i, tenant := range want {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		// A tenant is reconciled to the end even if the reconciler is stopped meanwhile
+		tenantCtx := log.WithTenant(context.WithoutCancel(ctx), tenant.GetId())
+		target, ok := targets[tenant.GetClusterId()]
+		if !ok {
+			err := fmt.Errorf("cluster %s of tenant %s is not available", tenant.GetClusterId(), tenant.GetId())
+			log.FromContext(tenantCtx).Error("Skipping tenant", zap.Error(err))
+			unplaced[tenant.GetId()] = true
+			metrics.ReconcileQueueDepth.Dec()
+			r.countTenantError(tenant.GetId())
+			errs = append(errs, err)
+			if err := r.reportSkipped(tenantCtx, storedTenants[i], ReasonClusterUnavailable, err); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		wantServers[tenant.GetId()] = map[string]bool{target.Server: true}
+		start := time.Now()
+		spanCtx, span := tracing.Tracer.Start(tenantCtx, "reconcile tenant", trace.WithAttributes(attribute.String("tenant.id", tenant.GetId())))
+		err := r.reconcileTenant(spanCtx, tenant, storedTenants[i], target)
+		tracing.End(span, err)
+		metrics.TenantReconcileDuration.Observe(time.Since(start).Seconds())
+		metrics.ReconcileQueueDepth.Dec()
+		if err != nil {
+			r.countTenantError(tenant.GetId())
+			log.FromContext(tenantCtx).Error("Failed to reconcile tenant", zap.Error(err))
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant.GetId(), err))
+		}
+	}
+
+	// Tenants being moved also live on their target cluster
+	for _, operation := range operations {
+		if target, ok := targets[operation.TargetClusterID]; ok && wantServers[operation.TenantID] != nil {
+			wantServers[operation.TenantID][target.Server] = true
+		}
+	}
 
-	toDelete := map[string]string{}
-	for _, tenantID := range existing {
-		toDelete[tenantID] = tenantID
+	if err := ctx.Err(); err != nil {
+		return errors.Join(append(errs, err)...)
 	}
-	for _, tenant := range want {
-		delete(toDelete, tenant.GetId())
+	if err := r.reconcileOperations(ctx, targets, want, invalid, operations); err != nil {
+		errs = append(errs, err)
 	}
 
-	// Delete tenants that are not in the desired state
-	for _, tenantID := range toDelete {
-		if err := r.deleteTenant(log.WithTenant(ctx, tenantID), tenantID); err != nil {
-			return err
+	// Several registered clusters may point to the same server, only scan each once
+	scanned := map[string]bool{}
+	var orphans []orphan
+	managed := 0
+	for _, target := range targets {
+		if scanned[target.Server] {
+			continue
+		}
+		scanned[target.Server] = true
+
+		// Existing is the current state
+		existing, err := getExistingTenants(ctx, target.Client)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list tenants on %s: %w", target.Server, err))
+			continue
+		}
+
+		for _, tenant := range existing {
+			tenantID := tenant.id
+			tenantCtx := log.WithTenant(ctx, tenantID)
+			if unplaced[tenantID] {
+				continue
+			}
+			servers, ok := wantServers[tenantID]
+			if !servers[target.Server] && !tenant.managed() {
+				// Namespaces the service did not create are left until they are imported
+				log.FromContext(tenantCtx).Info("Skipping unmanaged namespace", zap.String("server", target.Server))
+				continue
+			}
+			managed++
+			if !ok {
+				// Tenants that are not in the desired state are deleted once every namespace is scanned
+				orphans = append(orphans, orphan{existingTenant: tenant, target: target})
+				continue
+			}
+			if !servers[target.Server] {
+				// The tenant lives on another cluster, only remove the stray namespace
+				log.FromContext(tenantCtx).Info("Deleting namespace from previous cluster", zap.String("server", target.Server))
+				if err := deleteTenantNamespace(tenantCtx, target.Client, tenantID); err != nil {
+					errs = append(errs, fmt.Errorf("failed to delete namespace of tenant %s on %s: %w", tenantID, target.Server, err))
+				}
+			}
 		}
 	}
 
-	return nil
+	if err := r.reconcileOrphans(ctx, orphans, managed); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
 type Tenant struct {
@@ -120,7 +285,7 @@ func getNamespaceTenant(namespace corev1.Namespace) (string, error) {
 	if namespace.Labels == nil {
 		return "", fmt.Errorf("no labels")
 	}
-	tenant, ok := namespace.Labels[tenantLabel]
+	tenant, ok := namespace.Labels[constants.TenantLabel]
 	if !ok {
 		return "", fmt.Errorf("no tenant label")
 	}
@@ -131,253 +296,234 @@ func getNamespaceTenant(namespace corev1.Namespace) (string, error) {
 }
 
 // deleteTenant deletes a tenant by deleting the namespace and the application
-func (r *Reconciler) deleteTenant(ctx context.Context, tenantID string) error {
+func (r *Reconciler) deleteTenant(ctx context.Context, client kubernetes.Interface, tenantID string) error {
 	l := log.FromContext(ctx)
 	l.Info("Deleting tenant")
-	if err := deleteTenantApp(ctx, r.dynamicClient, tenantID); err != nil {
+	if err := r.deleteTenantApp(ctx, tenantID); err != nil {
 		return err
 	}
-	if err := deleteTenantNamespace(ctx, r.client, tenantID); err != nil {
+	namespaceName := constants.NamespaceNameForTenant(tenantID)
+	r.recorder(client).Eventf(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespaceName}}, corev1.EventTypeNormal, ReasonDeleting, "Deleting namespace %s of tenant %s", namespaceName, tenantID)
+	if err := deleteTenantNamespace(ctx, client, tenantID); err != nil {
 		return err
 	}
 	return nil
 }
 
 // deleteTenantApp deletes the tenant application
-func deleteTenantApp(ctx context.Context, dynamicClient dynamic.Interface, tenant string) error {
-
-	l := log.FromContext(ctx)
-
-	got, err := dynamicClient.Resource(constants.ArgoApplicationsGVR).Namespace(constants.OpenshiftGitopsNamespace).Get(ctx, constants.NamespaceNameForTenant(tenant), metav1.GetOptions{})
-	if err != nil {
-		if errors.IsNotFound(err) {
-			l.Info("Application already deleted", zap.String("name", constants.NamespaceNameForTenant(tenant)))
-			return nil
-		}
+func (r *Reconciler) deleteTenantApp(ctx context.Context, tenant string) error {
+	if err := r.deployer.Delete(ctx, constants.MoveApplicationNameForTenant(tenant)); err != nil {
 		return err
 	}
-
-	if got.GetDeletionTimestamp() == nil {
-		l.Info("Deleting application", zap.String("name", constants.NamespaceNameForTenant(tenant)))
-		err = dynamicClient.Resource(constants.ArgoApplicationsGVR).Namespace(constants.OpenshiftGitopsNamespace).Delete(ctx, constants.NamespaceNameForTenant(tenant), metav1.DeleteOptions{})
-		if !errors.IsNotFound(err) {
-			return err
-		}
-		return nil
-	}
-
-	// wait for deletion
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("timed out waiting for deletion")
-		case <-ticker.C:
-			got, err = dynamicClient.Resource(constants.ArgoApplicationsGVR).Namespace(constants.OpenshiftGitopsNamespace).Get(ctx, constants.NamespaceNameForTenant(tenant), metav1.GetOptions{})
-			if err != nil {
-				if errors.IsNotFound(err) {
-					l.Info("Application deleted", zap.String("name", constants.NamespaceNameForTenant(tenant)))
-					return nil
-				}
-				return err
-			}
-		}
-	}
+	return r.deployer.Delete(ctx, constants.ApplicationNameForTenant(tenant))
 }
 
 // deleteTenantNamespace deletes the tenant namespace
 func deleteTenantNamespace(ctx context.Context, client kubernetes.Interface, tenantID string) error {
 	err := client.CoreV1().Namespaces().Delete(ctx, constants.NamespaceNameForTenant(tenantID), metav1.DeleteOptions{})
-	if !errors.IsNotFound(err) {
+	if !apierrors.IsNotFound(err) {
 		return err
 	}
 	return nil
 }
 
-// ensureTenantApplication ensures that the tenant application exists
-func (r *Reconciler) ensureTenantApplication(ctx context.Context, tenant *v1.Tenant) error {
-	l := log.FromContext(ctx)
-	apps := r.dynamicClient.Resource(constants.ArgoApplicationsGVR)
-	want, err := makeTenantApplication(tenant)
-	if err != nil {
-		return fmt.Errorf("failed to build desired application: %w", err)
-	}
-	got, err := apps.Namespace(constants.OpenshiftGitopsNamespace).Get(ctx, want.GetName(), metav1.GetOptions{})
-	if err != nil {
-		if !errors.IsNotFound(err) {
-			return fmt.Errorf("failed to get application: %w", err)
-		}
-		l.Info("Creating application")
-		if _, err := apps.Namespace(constants.OpenshiftGitopsNamespace).Create(ctx, want, metav1.CreateOptions{}); err != nil {
-			return fmt.Errorf("failed to create application: %w", err)
-		}
-		return nil
-	}
-
-	gotSpec := got.Object["spec"]
-	wantSpec := want.Object["spec"]
-	if reflect.DeepEqual(gotSpec, wantSpec) {
-		return nil
-	}
-
-	// update
-	l.Info("Updating application")
-	got.Object["spec"] = wantSpec
-	if _, err := apps.Namespace(constants.OpenshiftGitopsNamespace).Update(ctx, got, metav1.UpdateOptions{}); err != nil {
-		return fmt.Errorf("failed to update application: %w", err)
-	}
-
-	return nil
-
-}
-
-// ensureTenantNamespace ensures that a namespace exists with the correct labels
-func (r *Reconciler) ensureTenantNamespace(ctx context.Context, tenant *v1.Tenant) error {
+// ensureTenantNamespace ensures that a namespace exists with the correct labels on the tenant cluster and returns it
+func (r *Reconciler) ensureTenantNamespace(ctx context.Context, client kubernetes.Interface, tenant *v1.Tenant) (*corev1.Namespace, error) {
 	l := log.FromContext(ctx)
 
-	wantLabels := map[string]string{
-		isTenantLabel:   "true",
-		tenantLabel:     tenant.GetId(),
-		argoCdManagedBy: managedByOpenshiftGitops,
-	}
+	wantLabels := deploy.TenantNamespaceLabels(r.deployer, tenant.GetId())
 
 	namespaceName := constants.NamespaceNameForTenant(tenant.GetId())
 
-	got, err := r.client.CoreV1().Namespaces().Get(ctx, namespaceName, metav1.GetOptions{})
+	got, err := client.CoreV1().Namespaces().Get(ctx, namespaceName, metav1.GetOptions{})
 	if err != nil {
-		if !errors.IsNotFound(err) {
-			return err
+		if !apierrors.IsNotFound(err) {
+			return nil, err
 		}
 		l.Info("Creating namespace", zap.String("name", namespaceName))
-		if _, err := r.client.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		created, err := client.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:   namespaceName,
-				Labels: wantLabels,
+				Name:        namespaceName,
+				Labels:      wantLabels,
+				Annotations: map[string]string{constants.ManagedAnnotation: "true"},
 			},
-		}, metav1.CreateOptions{}); err != nil {
-			return fmt.Errorf("failed to create namespace: %w", err)
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create namespace: %w", err)
 		}
-		return nil
+		return created, nil
 	}
 
-	shouldUpdate := false
-
-	if got.Labels == nil {
-		shouldUpdate = true
-		got.Labels = map[string]string{}
-	}
-	for k, v := range wantLabels {
-		if got.Labels[k] != v {
-			shouldUpdate = true
+	if got.Annotations[constants.ManagedAnnotation] != "true" {
+		// Namespaces that existed before their tenant are adopted as they are
+		l.Info("Adopting namespace", zap.String("name", namespaceName))
+		if got.Labels == nil {
+			got.Labels = map[string]string{}
+		}
+		for k, v := range wantLabels {
 			got.Labels[k] = v
 		}
-	}
-
-	if shouldUpdate {
-		l.Info("Updating namespace", zap.String("name", namespaceName))
-		if _, err := r.client.CoreV1().Namespaces().Update(ctx, got, metav1.UpdateOptions{}); err != nil {
-			return fmt.Errorf("failed to update namespace: %w", err)
+		if got.Annotations == nil {
+			got.Annotations = map[string]string{}
 		}
+		got.Annotations[constants.ManagedAnnotation] = "true"
+		adopted, err := client.CoreV1().Namespaces().Update(ctx, got, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to adopt namespace: %w", err)
+		}
+		return adopted, nil
 	}
 
-	return nil
-
-}
-
-// makeTenantApplication creates an ArgoCD Application object for a tenant
-func makeTenantApplication(tenant *v1.Tenant) (*unstructured.Unstructured, error) {
-	u := &unstructured.Unstructured{}
-	u.SetNamespace(constants.OpenshiftGitopsNamespace)
-	u.SetName(constants.ApplicationNameForTenant(tenant.GetId()))
-	u.SetLabels(map[string]string{
-		isTenantLabel: "true",
-		tenantLabel:   tenant.GetId(),
-	})
-	u.SetGroupVersionKind(constants.ArgoApplicationGVK)
-
-	source := map[string]interface{}{
-		"repoURL": defaultRepoURL,
-		"path":    defaultRepoPath,
+	if _, ok := got.Annotations[constants.OrphanedAtAnnotation]; ok {
+		// The tenant is back before its namespace was deleted
+		l.Info("Clearing orphaned namespace", zap.String("name", namespaceName))
+		delete(got.Annotations, constants.OrphanedAtAnnotation)
+		if got, err = client.CoreV1().Namespaces().Update(ctx, got, metav1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to update namespace: %w", err)
+		}
 	}
 
-	if repoURL := tenant.GetSource().GetRepoUrl(); len(repoURL) > 0 {
-		source["repoURL"] = repoURL
+	// Labels are only written on creation, a label that differs was changed out of band
+	liveLabels := map[string]interface{}{}
+	for k, v := range got.Labels {
+		liveLabels[k] = v
 	}
-	if path := tenant.GetSource().GetPath(); len(path) > 0 {
-		source["path"] = path
+	desiredLabels := map[string]interface{}{}
+	for k, v := range wantLabels {
+		desiredLabels[k] = v
 	}
-	if targetRevision := tenant.GetSource().GetTargetRevision(); len(targetRevision) > 0 {
-		source["targetRevision"] = targetRevision
+	drifted, err := deploy.DiffFields(
+		map[string]interface{}{"metadata": map[string]interface{}{"labels": liveLabels}},
+		map[string]interface{}{"metadata": map[string]interface{}{"labels": desiredLabels}},
+	)
+	if err != nil {
+		return nil, err
 	}
-
-	helm := map[string]interface{}{
-		"releaseName": constants.NamespaceNameForTenant(tenant.GetId()),
+	labelsJson, err := json.Marshal(got.Labels)
+	if err != nil {
+		return nil, err
 	}
 
-	if values := tenant.GetSource().GetHelm().GetValues().AsMap(); len(values) > 0 {
-		yamlBytes, err := yaml.Marshal(values)
+	if len(drifted) > 0 {
+		correct, err := deploy.RecordDrift(ctx, deploy.Drift{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       namespaceName,
+			UID:        got.UID,
+			Fields:     drifted,
+			Digest:     string(labelsJson),
+		})
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to record namespace drift: %w", err)
+		}
+		if !correct {
+			l.Info("Leaving drifted namespace", zap.String("name", namespaceName))
+			return got, nil
+		}
+		if got.Labels == nil {
+			got.Labels = map[string]string{}
+		}
+		for k, v := range wantLabels {
+			got.Labels[k] = v
+		}
+		l.Info("Updating namespace", zap.String("name", namespaceName))
+		if got, err = client.CoreV1().Namespaces().Update(ctx, got, metav1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to update namespace: %w", err)
 		}
-		helm["values"] = string(yamlBytes)
-	}
-
-	source["helm"] = helm
-
-	u.Object["spec"] = map[string]interface{}{
-		"project": "default",
-		"source":  source,
-		"destination": map[string]interface{}{
-			"server":    "https://kubernetes.default.svc",
-			"namespace": constants.NamespaceNameForTenant(tenant.GetId()),
-		},
-		"syncPolicy": map[string]interface{}{
-			"automated": map[string]interface{}{
-				"prune":    true,
-				"selfHeal": true,
-			},
-		},
 	}
 
-	return u, nil
+	return got, nil
+
+}
+
+// existingTenant is a tenant found on a cluster from its namespace
+type existingTenant struct {
+	id        string
+	namespace corev1.Namespace
+}
+
+// managed tells whether the namespace of the tenant was created or adopted by the service
+func (t existingTenant) managed() bool {
+	return t.namespace.Annotations[constants.ManagedAnnotation] == "true"
 }
 
-// getExistingTenantIDs returns a list of existing tenants ids
-func (r *Reconciler) getExistingTenantIDs(ctx context.Context) ([]string, error) {
-	namespaces, err := r.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=true", isTenantLabel),
+// getExistingTenants returns the tenants existing on a cluster
+func getExistingTenants(ctx context.Context, client kubernetes.Interface) ([]existingTenant, error) {
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=true", constants.IsTenantLabel),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	var tenants []string
+	var tenants []existingTenant
 	for _, ns := range namespaces.Items {
 		tenantID, err := getNamespaceTenant(ns)
 		if err != nil {
 			return nil, err
 		}
-		tenants = append(tenants, tenantID)
+		tenants = append(tenants, existingTenant{id: tenantID, namespace: ns})
 	}
 
 	return tenants, nil
 }
 
-// getWant reads the desired state from a file
-func (r *Reconciler) getWant(ctx context.Context) ([]*v1.Tenant, error) {
+// countTenantError counts a failed reconciliation of a tenant
+func (r *Reconciler) countTenantError(tenantID string) {
+	metrics.TenantReconcileErrors.WithLabelValues(tenantID).Inc()
+	r.erroredTenants[tenantID] = true
+}
+
+// forgetDeletedTenants removes the error series of the tenants that are no longer stored
+func (r *Reconciler) forgetDeletedTenants(storedTenants []store.Tenant) {
+	stored := make(map[string]bool, len(storedTenants))
+	for _, storedTenant := range storedTenants {
+		stored[storedTenant.ID] = true
+	}
+	for tenantID := range r.erroredTenants {
+		if !stored[tenantID] {
+			metrics.TenantReconcileErrors.DeleteLabelValues(tenantID)
+			delete(r.erroredTenants, tenantID)
+		}
+	}
+}
+
+// invalidTenant is a stored tenant left out of the desired state as it cannot be read
+type invalidTenant struct {
+	stored store.Tenant
+	err    error
+}
+
+// getWant reads the desired state from the store. Tenants that cannot be read are returned apart,
+// they must not hold back the others nor be taken for deleted ones.
+func (r *Reconciler) getWant(ctx context.Context) ([]*v1.Tenant, []store.Tenant, map[string]invalidTenant, error) {
 
 	storedTenants, err := r.store.ListTenants(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	tenants, err := convert.TenantsFromStore(storedTenants)
-	if err != nil {
-		return nil, err
+	var tenants []*v1.Tenant
+	var validTenants []store.Tenant
+	invalid := map[string]invalidTenant{}
+	for _, storedTenant := range storedTenants {
+		tenant, err := convert.TenantFromStore(storedTenant)
+		if err != nil {
+			invalid[storedTenant.ID] = invalidTenant{stored: storedTenant, err: fmt.Errorf("failed to read tenant %s: %w", storedTenant.ID, err)}
+			continue
+		}
+		// Secret values are only decrypted here, to be handed to the deployer
+		secretValues, err := r.secrets.OpenValues(ctx, storedTenant.SecretValues)
+		if err != nil {
+			invalid[storedTenant.ID] = invalidTenant{stored: storedTenant, err: fmt.Errorf("failed to decrypt secret values of tenant %s: %w", storedTenant.ID, err)}
+			continue
+		}
+		if secretValues != nil {
+			tenant.Source.Helm.SecretValues = secretValues
+		}
+		tenants = append(tenants, tenant)
+		validTenants = append(validTenants, storedTenant)
 	}
 
-	return tenants, nil
+	return tenants, validTenants, invalid, nil
 }
@@ -0,0 +1,135 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/store"
+	"poc-cloud-service/log"
+	"strings"
+)
+
+// scaler reads and updates the scale of the workloads of a kind
+type scaler interface {
+	GetScale(ctx context.Context, name string, options metav1.GetOptions) (*autoscalingv1.Scale, error)
+	UpdateScale(ctx context.Context, name string, scale *autoscalingv1.Scale, options metav1.UpdateOptions) (*autoscalingv1.Scale, error)
+}
+
+// reconcileSuspension scales the workloads of a tenant suspended with scale down to zero, once the deployer stopped syncing them.
+// Their replicas are stored first, and restored once the tenant is resumed.
+func (r *Reconciler) reconcileSuspension(ctx context.Context, client kubernetes.Interface, storedTenant store.Tenant) error {
+	l := log.FromContext(ctx)
+	namespace := constants.NamespaceNameForTenant(storedTenant.ID)
+	replicas := map[string]int32{}
+	if err := json.Unmarshal(storedTenant.SuspendedReplicas, &replicas); err != nil {
+		return fmt.Errorf("failed to decode suspended replicas: %w", err)
+	}
+	scalers := map[string]scaler{
+		"Deployment":  client.AppsV1().Deployments(namespace),
+		"StatefulSet": client.AppsV1().StatefulSets(namespace),
+	}
+
+	if !storedTenant.Suspended || !storedTenant.ScaleDown {
+		if len(replicas) == 0 {
+			return nil
+		}
+		for key, count := range replicas {
+			kind, name, _ := strings.Cut(key, "/")
+			l.Info("Restoring replicas", zap.String("kind", kind), zap.String("name", name), zap.Int32("replicas", count))
+			if err := scale(ctx, scalers[kind], name, count); err != nil {
+				return fmt.Errorf("failed to restore %s %s: %w", kind, name, err)
+			}
+		}
+		_, err := r.store.SetTenantSuspendedReplicas(ctx, store.SetTenantSuspendedReplicasParams{
+			ID:                storedTenant.ID,
+			SuspendedReplicas: []byte("{}"),
+		})
+		return err
+	}
+
+	// Replicas are only recorded the first time a workload is seen scaled up, later passes find it at zero
+	toScale := map[string]int32{}
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments.Items {
+		if d.Spec.Replicas == nil || *d.Spec.Replicas > 0 {
+			toScale["Deployment/"+d.Name] = replicasOrDefault(d.Spec.Replicas)
+		}
+	}
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, st := range statefulSets.Items {
+		if st.Spec.Replicas == nil || *st.Spec.Replicas > 0 {
+			toScale["StatefulSet/"+st.Name] = replicasOrDefault(st.Spec.Replicas)
+		}
+	}
+	if len(toScale) == 0 {
+		return nil
+	}
+
+	changed := false
+	for key, count := range toScale {
+		if _, ok := replicas[key]; !ok {
+			replicas[key] = count
+			changed = true
+		}
+	}
+	if changed {
+		replicasJson, err := json.Marshal(replicas)
+		if err != nil {
+			return err
+		}
+		if _, err := r.store.SetTenantSuspendedReplicas(ctx, store.SetTenantSuspendedReplicasParams{
+			ID:                storedTenant.ID,
+			SuspendedReplicas: replicasJson,
+		}); err != nil {
+			return fmt.Errorf("failed to store suspended replicas: %w", err)
+		}
+	}
+	for key := range toScale {
+		kind, name, _ := strings.Cut(key, "/")
+		l.Info("Scaling down", zap.String("kind", kind), zap.String("name", name))
+		if err := scale(ctx, scalers[kind], name, 0); err != nil {
+			return fmt.Errorf("failed to scale down %s %s: %w", kind, name, err)
+		}
+	}
+	return nil
+}
+
+// scale sets the replicas of a workload, workloads that are gone are skipped
+func scale(ctx context.Context, s scaler, name string, replicas int32) error {
+	if s == nil {
+		return nil
+	}
+	current, err := s.GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if current.Spec.Replicas == replicas {
+		return nil
+	}
+	current.Spec.Replicas = replicas
+	_, err = s.UpdateScale(ctx, name, current, metav1.UpdateOptions{})
+	return err
+}
+
+// replicasOrDefault returns the replicas of a workload spec, which default to one
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
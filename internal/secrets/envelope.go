@@ -0,0 +1,134 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const dataKeySize = 32
+
+// ErrNotConfigured is returned when secret values are used without a key
+var ErrNotConfigured = errors.New("secret values encryption is not configured")
+
+// KMS wraps the data keys that secret values are encrypted with
+type KMS interface {
+	// KeyID identifies the key wrapping new data keys
+	KeyID() string
+	// Wrap encrypts a data key
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	// Unwrap decrypts a data key wrapped by the key keyID
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Envelope encrypts each payload with its own data key, itself wrapped by the KMS.
+// A nil Envelope refuses to seal or open anything.
+type Envelope struct {
+	kms KMS
+}
+
+func NewEnvelope(kms KMS) *Envelope {
+	return &Envelope{kms: kms}
+}
+
+// sealed is what is stored for an encrypted payload
+type sealed struct {
+	KeyID      string `json:"keyId"`
+	WrappedKey []byte `json:"wrappedKey"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Seal encrypts plaintext with a new data key
+func (e *Envelope) Seal(ctx context.Context, plaintext []byte) ([]byte, error) {
+	if e == nil {
+		return nil, ErrNotConfigured
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	wrapped, err := e.kms.Wrap(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return json.Marshal(sealed{
+		KeyID:      e.kms.KeyID(),
+		WrappedKey: wrapped,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// Open decrypts a payload written by Seal
+func (e *Envelope) Open(ctx context.Context, data []byte) ([]byte, error) {
+	if e == nil {
+		return nil, ErrNotConfigured
+	}
+	var s sealed
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode sealed payload: %w", err)
+	}
+	dataKey, err := e.kms.Unwrap(ctx, s.KeyID, s.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, s.Nonce, s.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealValues encrypts helm values, nothing is stored for empty values
+func (e *Envelope) SealValues(ctx context.Context, values *structpb.Struct) ([]byte, error) {
+	if len(values.GetFields()) == 0 {
+		return nil, nil
+	}
+	plaintext, err := values.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return e.Seal(ctx, plaintext)
+}
+
+// OpenValues decrypts helm values sealed by SealValues
+func (e *Envelope) OpenValues(ctx context.Context, data []byte) (*structpb.Struct, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	plaintext, err := e.Open(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	values := &structpb.Struct{}
+	if err := values.UnmarshalJSON(plaintext); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LocalKMS wraps data keys with AES-256-GCM keys held in memory.
+// The first key wraps new data keys, the others are kept to unwrap data keys of rotated keys.
+type LocalKMS struct {
+	keyID string
+	keys  map[string][]byte
+}
+
+// NewLocalKMS builds a LocalKMS from base64 encoded 32 byte keys
+func NewLocalKMS(encodedKeys ...string) (*LocalKMS, error) {
+	if len(encodedKeys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+	kms := &LocalKMS{keys: map[string][]byte{}}
+	for i, encoded := range encodedKeys {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %d: %w", i, err)
+		}
+		if len(key) != dataKeySize {
+			return nil, fmt.Errorf("key %d must be %d bytes, got %d", i, dataKeySize, len(key))
+		}
+		sum := sha256.Sum256(key)
+		keyID := "local:" + hex.EncodeToString(sum[:4])
+		if i == 0 {
+			kms.keyID = keyID
+		}
+		kms.keys[keyID] = key
+	}
+	return kms, nil
+}
+
+// LoadLocalKMS reads the keys of a LocalKMS from a file, one base64 key per line
+func LoadLocalKMS(path string) (*LocalKMS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			keys = append(keys, line)
+		}
+	}
+	return NewLocalKMS(keys...)
+}
+
+func (k *LocalKMS) KeyID() string {
+	return k.keyID
+}
+
+func (k *LocalKMS) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	aead, err := newAEAD(k.keys[k.keyID])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (k *LocalKMS) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", keyID)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
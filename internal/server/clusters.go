@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/xid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/cluster"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/convert"
+	"poc-cloud-service/internal/store"
+)
+
+func (s *Server) ListClusters(ctx context.Context, request *v1.ListClustersRequest) (*v1.ListClustersResponse, error) {
+	clusters, err := s.listClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ListClustersResponse{Clusters: clusters}, nil
+}
+
+func (s *Server) GetCluster(ctx context.Context, request *v1.GetClusterRequest) (*v1.GetClusterResponse, error) {
+	storedCluster, err := s.store.GetClusterByID(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.GetClusterResponse{}
+	resp.Cluster, err = convert.ClusterFromStore(storedCluster)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.tenantCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp.Cluster.TenantCount = counts[resp.Cluster.GetId()]
+	return resp, nil
+}
+
+func (s *Server) CreateCluster(ctx context.Context, request *v1.CreateClusterRequest) (*v1.CreateClusterResponse, error) {
+	if err := validateCluster(request.GetCluster()); err != nil {
+		return nil, err
+	}
+	labelsJson, err := json.Marshal(request.GetCluster().GetLabels())
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.store.CreateCluster(ctx, store.CreateClusterParams{
+		ID:               xid.New().String(),
+		Name:             request.GetCluster().GetName(),
+		Server:           request.GetCluster().GetServer(),
+		Region:           request.GetCluster().GetRegion(),
+		Labels:           labelsJson,
+		Capacity:         request.GetCluster().GetCapacity(),
+		KubeconfigSecret: request.GetCluster().GetKubeconfigSecret(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.CreateClusterResponse{}
+	resp.Cluster, err = convert.ClusterFromStore(created)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) UpdateCluster(ctx context.Context, request *v1.UpdateClusterRequest) (*v1.UpdateClusterResponse, error) {
+	if err := validateCluster(request.GetCluster()); err != nil {
+		return nil, err
+	}
+	labelsJson, err := json.Marshal(request.GetCluster().GetLabels())
+	if err != nil {
+		return nil, err
+	}
+	var updated store.Cluster
+	err = s.db.InTx(ctx, func(q *store.Queries) error {
+		existing, err := q.GetClusterByIDForUpdate(ctx, request.GetId())
+		if err != nil {
+			return err
+		}
+		// The namespaces and deployments of the tenants would be left behind on the previous server
+		if request.GetCluster().GetServer() != existing.Server {
+			placed, err := placedTenants(ctx, q, request.GetId())
+			if err != nil {
+				return err
+			}
+			if placed > 0 {
+				return status.Errorf(codes.FailedPrecondition, "the server of cluster %s cannot change while it has %d tenants", request.GetId(), placed)
+			}
+		}
+		updated, err = q.UpdateCluster(ctx, store.UpdateClusterParams{
+			ID:               request.GetId(),
+			Name:             request.GetCluster().GetName(),
+			Server:           request.GetCluster().GetServer(),
+			Region:           request.GetCluster().GetRegion(),
+			Labels:           labelsJson,
+			Capacity:         request.GetCluster().GetCapacity(),
+			KubeconfigSecret: request.GetCluster().GetKubeconfigSecret(),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.UpdateClusterResponse{}
+	resp.Cluster, err = convert.ClusterFromStore(updated)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) DeleteCluster(ctx context.Context, request *v1.DeleteClusterRequest) (*v1.DeleteClusterResponse, error) {
+	var deleted store.Cluster
+	err := s.db.InTx(ctx, func(q *store.Queries) error {
+		if _, err := q.GetClusterByIDForUpdate(ctx, request.GetId()); err != nil {
+			return err
+		}
+		placed, err := placedTenants(ctx, q, request.GetId())
+		if err != nil {
+			return err
+		}
+		if placed > 0 {
+			return status.Errorf(codes.FailedPrecondition, "cluster %s still has %d tenants", request.GetId(), placed)
+		}
+		deleted, err = q.DeleteCluster(ctx, request.GetId())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.DeleteClusterResponse{}
+	resp.Cluster, err = convert.ClusterFromStore(deleted)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// schedule resolves the placement of a new tenant to a cluster id
+func (s *Server) schedule(ctx context.Context, placement *v1.Placement) (string, error) {
+	clusters, err := s.listClusters(ctx)
+	if err != nil {
+		return "", err
+	}
+	clusterID, err := cluster.Schedule(clusters, placement)
+	if err != nil {
+		if errors.Is(err, cluster.ErrClusterNotFound) {
+			return "", status.Error(codes.InvalidArgument, err.Error())
+		}
+		return "", status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return clusterID, nil
+}
+
+// lockClusterCapacity locks a cluster until the transaction of q ends, failing when it has no room for another tenant.
+// Tenants placed or scheduled on the cluster while it is locked wait for the transaction, so the count stays accurate.
+// The local cluster, whose id is empty, has no capacity.
+func lockClusterCapacity(ctx context.Context, q *store.Queries, clusterID string) error {
+	if clusterID == "" {
+		return nil
+	}
+	locked, err := q.GetClusterByIDForUpdate(ctx, clusterID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return status.Error(codes.InvalidArgument, cluster.ErrClusterNotFound.Error())
+		}
+		return err
+	}
+	if locked.Capacity == 0 {
+		return nil
+	}
+	placed, err := placedTenants(ctx, q, clusterID)
+	if err != nil {
+		return err
+	}
+	if placed >= int64(locked.Capacity) {
+		return status.Error(codes.ResourceExhausted, cluster.ErrClusterFull.Error())
+	}
+	return nil
+}
+
+// placedTenants counts the tenants of a cluster, including the ones being moved to it
+func placedTenants(ctx context.Context, q *store.Queries, clusterID string) (int64, error) {
+	tenants, err := q.CountTenantsInCluster(ctx, clusterID)
+	if err != nil {
+		return 0, err
+	}
+	moving, err := q.CountActiveOperationsToCluster(ctx, store.CountActiveOperationsToClusterParams{
+		TargetClusterID: clusterID,
+		State:           constants.ActiveOperationStates,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return tenants + moving, nil
+}
+
+// listClusters returns the registered clusters with their tenant counts
+func (s *Server) listClusters(ctx context.Context) ([]*v1.Cluster, error) {
+	storedClusters, err := s.store.ListClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.tenantCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make([]*v1.Cluster, 0, len(storedClusters))
+	for _, storedCluster := range storedClusters {
+		c, err := convert.ClusterFromStore(storedCluster)
+		if err != nil {
+			return nil, err
+		}
+		c.TenantCount = counts[c.GetId()]
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+func (s *Server) tenantCounts(ctx context.Context) (map[string]int32, error) {
+	rows, err := s.store.CountTenantsByCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int32, len(rows))
+	for _, row := range rows {
+		counts[row.ClusterID] = int32(row.Count)
+	}
+	return counts, nil
+}
+
+func validateCluster(c *v1.Cluster) error {
+	if c.GetName() == "" {
+		return status.Error(codes.InvalidArgument, "cluster name is required")
+	}
+	if c.GetServer() == "" {
+		return status.Error(codes.InvalidArgument, "cluster server is required")
+	}
+	if c.GetCapacity() < 0 {
+		return status.Error(codes.InvalidArgument, "cluster capacity must not be negative")
+	}
+	return nil
+}
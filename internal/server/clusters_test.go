@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/store"
+	"reflect"
+	"testing"
+)
+
+// fakeDB answers the cluster queries from a single cluster, recording the queries that write it.
+// Tenants are read empty, operation is the id of the active operation of every tenant.
+type fakeDB struct {
+	cluster   store.Cluster
+	tenants   int64
+	moving    int64
+	operation string
+	writes    []string
+	commits   int
+}
+
+func (d *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: d}, nil
+}
+
+func (d *fakeDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	panic("unexpected exec " + store.QueryName(sql))
+}
+
+func (d *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	panic("unexpected query " + store.QueryName(sql))
+}
+
+func (d *fakeDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	c := d.cluster
+	clusterRow := fakeRow{c.ID, c.Name, c.Server, c.Region, c.Labels, c.Capacity, c.KubeconfigSecret}
+	switch name := store.QueryName(sql); name {
+	case "GetClusterByIDForUpdate":
+		return clusterRow
+	case "CountTenantsInCluster":
+		return fakeRow{d.tenants}
+	case "CountActiveOperationsToCluster":
+		return fakeRow{d.moving}
+	case "GetTenantByID":
+		return fakeRow{}
+	case "GetActiveOperationByTenant":
+		if d.operation == "" {
+			return errRow{pgx.ErrNoRows}
+		}
+		return fakeRow{d.operation}
+	case "UpdateCluster", "DeleteCluster", "CreateTenant", "UpdateTenant":
+		d.writes = append(d.writes, name)
+		return clusterRow
+	default:
+		panic("unexpected query " + name)
+	}
+}
+
+// fakeTx runs its queries on the fake database, counting commits
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDB
+}
+
+func (t *fakeTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return t.db.Exec(ctx, sql, args...)
+}
+
+func (t *fakeTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return t.db.Query(ctx, sql, args...)
+}
+
+func (t *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return t.db.QueryRow(ctx, sql, args...)
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.db.commits++
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+// fakeRow scans its values in order, leaving the destinations it has no value for
+type fakeRow []interface{}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	for i, value := range r {
+		if i < len(dest) {
+			reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+		}
+	}
+	return nil
+}
+
+// errRow fails to scan with err
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+func newFakeServer(db *fakeDB) *Server {
+	return &Server{
+		store: store.New(db),
+		db:    store.NewTransactor(db, func(db store.DBTX) store.DBTX { return db }),
+	}
+}
+
+func TestUpdateClusterServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  string
+		tenants int64
+		moving  int64
+		code    codes.Code
+	}{
+		{"same server with tenants", "https://a.example.com", 1, 0, codes.OK},
+		{"new server without tenants", "https://b.example.com", 0, 0, codes.OK},
+		{"new server with tenants", "https://b.example.com", 1, 0, codes.FailedPrecondition},
+		{"new server with a tenant moving in", "https://b.example.com", 0, 1, codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{
+				cluster: store.Cluster{ID: "c1", Name: "a", Server: "https://a.example.com", Labels: []byte("{}")},
+				tenants: tt.tenants,
+				moving:  tt.moving,
+			}
+			_, err := newFakeServer(db).UpdateCluster(context.Background(), &v1.UpdateClusterRequest{
+				Id:      "c1",
+				Cluster: &v1.Cluster{Name: "a", Server: tt.server},
+			})
+			if status.Code(err) != tt.code {
+				t.Fatalf("expected %s, got %v", tt.code, err)
+			}
+			if tt.code == codes.OK && (len(db.writes) != 1 || db.commits != 1) {
+				t.Fatalf("expected the cluster to be updated, got writes %v and %d commits", db.writes, db.commits)
+			}
+			if tt.code != codes.OK && (len(db.writes) != 0 || db.commits != 0) {
+				t.Fatalf("expected nothing to be written, got writes %v and %d commits", db.writes, db.commits)
+			}
+		})
+	}
+}
+
+func TestDeleteClusterWithTenants(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants int64
+		moving  int64
+		code    codes.Code
+	}{
+		{"empty", 0, 0, codes.OK},
+		{"tenants", 2, 0, codes.FailedPrecondition},
+		{"tenant moving in", 0, 1, codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{
+				cluster: store.Cluster{ID: "c1", Name: "a", Server: "https://a.example.com", Labels: []byte("{}")},
+				tenants: tt.tenants,
+				moving:  tt.moving,
+			}
+			_, err := newFakeServer(db).DeleteCluster(context.Background(), &v1.DeleteClusterRequest{Id: "c1"})
+			if status.Code(err) != tt.code {
+				t.Fatalf("expected %s, got %v", tt.code, err)
+			}
+			if deleted := reflect.DeepEqual(db.writes, []string{"DeleteCluster"}); deleted != (tt.code == codes.OK) {
+				t.Fatalf("unexpected writes %v", db.writes)
+			}
+		})
+	}
+}
+
+func TestLockClusterCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int32
+		tenants  int64
+		moving   int64
+		code     codes.Code
+	}{
+		{"unlimited", 0, 10, 0, codes.OK},
+		{"room left", 3, 1, 1, codes.OK},
+		{"full", 2, 2, 0, codes.ResourceExhausted},
+		{"full with a tenant moving in", 2, 1, 1, codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{
+				cluster: store.Cluster{ID: "c1", Capacity: tt.capacity},
+				tenants: tt.tenants,
+				moving:  tt.moving,
+			}
+			err := lockClusterCapacity(context.Background(), store.New(db), "c1")
+			if status.Code(err) != tt.code {
+				t.Fatalf("expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+}
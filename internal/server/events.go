@@ -0,0 +1,23 @@
+package server
+
+import (
+	"context"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/convert"
+)
+
+func (s *Server) ListTenantEvents(ctx context.Context, request *v1.ListTenantEventsRequest) (*v1.ListTenantEventsResponse, error) {
+	if _, err := s.store.GetTenantByID(ctx, request.GetId()); err != nil {
+		return nil, err
+	}
+	events, err := s.store.ListTenantEvents(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.ListTenantEventsResponse{}
+	resp.Events, err = convert.TenantEventsFromStore(events)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/convert"
+	"poc-cloud-service/internal/deploy"
+)
+
+// ImportTenant creates a tenant from an existing namespace and application, which the reconciler then adopts
+func (s *Server) ImportTenant(ctx context.Context, request *v1.ImportTenantRequest) (*v1.ImportTenantResponse, error) {
+	id := request.GetId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "tenant id is required")
+	}
+	if _, err := s.store.GetTenantByID(ctx, id); err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "tenant %s already exists", id)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if err := s.checkPlan(ctx, request.GetPlanId()); err != nil {
+		return nil, err
+	}
+	target, err := s.clusters.Target(ctx, request.GetClusterId())
+	if err != nil {
+		return nil, err
+	}
+	namespace := constants.NamespaceNameForTenant(id)
+	if _, err := target.Client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{}); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "namespace %s not found", namespace)
+		}
+		return nil, err
+	}
+
+	tenant, err := s.deployer.Import(ctx, constants.ApplicationNameForTenant(id))
+	if err != nil {
+		if errors.Is(err, deploy.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "application %s not found", constants.ApplicationNameForTenant(id))
+		}
+		return nil, deployError(err)
+	}
+	tenant.Id = id
+	tenant.ClusterId = target.ID
+	tenant.PlanId = request.GetPlanId()
+	if err := validateSources(tenant.GetSource(), tenant.GetSources()); err != nil {
+		return nil, err
+	}
+	if request.GetValidateOnly() {
+		return &v1.ImportTenantResponse{Tenant: tenant}, nil
+	}
+	created, err := s.insertTenant(ctx, tenant, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.ImportTenantResponse{}
+	resp.Tenant, err = convert.TenantFromStore(created)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/xid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/convert"
+	"poc-cloud-service/internal/store"
+	"time"
+)
+
+const defaultMoveTimeout = 10 * time.Minute
+
+func (s *Server) MoveTenant(ctx context.Context, request *v1.MoveTenantRequest) (*v1.MoveTenantResponse, error) {
+	tenant, err := s.store.GetTenantByID(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if request.GetClusterId() == tenant.ClusterID {
+		return nil, status.Error(codes.InvalidArgument, "tenant is already on the target cluster")
+	}
+	if request.GetTimeoutSeconds() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "timeout must not be negative")
+	}
+	if err := s.ensureNoActiveOperation(ctx, tenant.ID); err != nil {
+		return nil, err
+	}
+
+	timeout := defaultMoveTimeout
+	if request.GetTimeoutSeconds() > 0 {
+		timeout = time.Duration(request.GetTimeoutSeconds()) * time.Second
+	}
+
+	// Moving back to the local cluster is always allowed, other targets must have room.
+	// The target is locked until the operation is stored, the operation then holds its room until the tenant is placed.
+	var created store.Operation
+	err = s.db.InTx(ctx, func(q *store.Queries) error {
+		if err := lockClusterCapacity(ctx, q, request.GetClusterId()); err != nil {
+			return err
+		}
+		created, err = q.CreateOperation(ctx, store.CreateOperationParams{
+			ID:              xid.New().String(),
+			TenantID:        tenant.ID,
+			Type:            constants.OperationTypeMove,
+			State:           v1.OperationState_OPERATION_STATE_PROVISIONING.String(),
+			SourceClusterID: tenant.ClusterID,
+			TargetClusterID: request.GetClusterId(),
+			Deadline:        pgtype.Timestamptz{Time: time.Now().Add(timeout), Valid: true},
+		})
+		return err
+	})
+	if err != nil {
+		// another operation was created since ensureNoActiveOperation
+		if store.IsUniqueViolation(err, store.ActiveOperationIndex) {
+			return nil, status.Errorf(codes.FailedPrecondition, "an operation is in progress for tenant %s", tenant.ID)
+		}
+		return nil, err
+	}
+	return &v1.MoveTenantResponse{Operation: convert.OperationFromStore(created)}, nil
+}
+
+func (s *Server) GetOperation(ctx context.Context, request *v1.GetOperationRequest) (*v1.GetOperationResponse, error) {
+	operation, err := s.store.GetOperationByID(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &v1.GetOperationResponse{Operation: convert.OperationFromStore(operation)}, nil
+}
+
+func (s *Server) ListOperations(ctx context.Context, request *v1.ListOperationsRequest) (*v1.ListOperationsResponse, error) {
+	var operations []store.Operation
+	var err error
+	if tenantID := request.GetTenantId(); tenantID != "" {
+		operations, err = s.store.ListOperationsByTenant(ctx, tenantID)
+	} else {
+		operations, err = s.store.ListOperations(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ListOperationsResponse{Operations: convert.OperationsFromStore(operations)}, nil
+}
+
+// ensureNoActiveOperation fails when an operation is in progress for the tenant
+func (s *Server) ensureNoActiveOperation(ctx context.Context, tenantID string) error {
+	operation, err := s.store.GetActiveOperationByTenant(ctx, store.GetActiveOperationByTenantParams{
+		TenantID: tenantID,
+		State:    constants.ActiveOperationStates,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	return status.Errorf(codes.FailedPrecondition, "operation %s is in progress for tenant %s", operation.ID, tenantID)
+}
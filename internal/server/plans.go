@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"github.com/rs/xid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/charts"
+	"poc-cloud-service/internal/convert"
+	"poc-cloud-service/internal/store"
+)
+
+func (s *Server) ListPlans(ctx context.Context, request *v1.ListPlansRequest) (*v1.ListPlansResponse, error) {
+	plans, err := s.store.ListPlans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.ListPlansResponse{}
+	resp.Plans, err = convert.PlansFromStore(plans)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) GetPlan(ctx context.Context, request *v1.GetPlanRequest) (*v1.GetPlanResponse, error) {
+	storedPlan, err := s.store.GetPlanByID(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.GetPlanResponse{}
+	resp.Plan, err = convert.PlanFromStore(storedPlan)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) CreatePlan(ctx context.Context, request *v1.CreatePlanRequest) (*v1.CreatePlanResponse, error) {
+	schemaJson, err := validatePlan(request.GetPlan())
+	if err != nil {
+		return nil, err
+	}
+	syncPolicyJson, err := convert.SyncPolicyToStore(request.GetPlan().GetSyncPolicy())
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.store.CreatePlan(ctx, store.CreatePlanParams{
+		ID:           xid.New().String(),
+		Name:         request.GetPlan().GetName(),
+		ValuesSchema: schemaJson,
+		SyncPolicy:   syncPolicyJson,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.CreatePlanResponse{}
+	resp.Plan, err = convert.PlanFromStore(created)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) UpdatePlan(ctx context.Context, request *v1.UpdatePlanRequest) (*v1.UpdatePlanResponse, error) {
+	schemaJson, err := validatePlan(request.GetPlan())
+	if err != nil {
+		return nil, err
+	}
+	syncPolicyJson, err := convert.SyncPolicyToStore(request.GetPlan().GetSyncPolicy())
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.store.GetPlanByID(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.store.UpdatePlan(ctx, store.UpdatePlanParams{
+		ID:           request.GetId(),
+		Name:         request.GetPlan().GetName(),
+		ValuesSchema: schemaJson,
+		SyncPolicy:   syncPolicyJson,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.UpdatePlanResponse{}
+	resp.Plan, err = convert.PlanFromStore(updated)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) DeletePlan(ctx context.Context, request *v1.DeletePlanRequest) (*v1.DeletePlanResponse, error) {
+	count, err := s.store.CountTenantsByPlan(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "plan %s still has %d tenants", request.GetId(), count)
+	}
+	deleted, err := s.store.DeletePlan(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.DeletePlanResponse{}
+	resp.Plan, err = convert.PlanFromStore(deleted)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// validatePlan checks a plan and returns its values schema as stored
+func validatePlan(p *v1.Plan) ([]byte, error) {
+	if p.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "plan name is required")
+	}
+	if err := validateSyncPolicy(p.GetSyncPolicy()); err != nil {
+		return nil, err
+	}
+	if len(p.GetValuesSchema().GetFields()) == 0 {
+		return []byte("{}"), nil
+	}
+	schemaJson, err := p.GetValuesSchema().MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := charts.CompileSchema(schemaJson); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return schemaJson, nil
+}
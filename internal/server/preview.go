@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/deploy"
+)
+
+// preview returns the diff of the objects the reconciler would write for a tenant, or delete when deleting is set
+func (s *Server) preview(ctx context.Context, tenant *v1.Tenant, deleting bool) ([]*v1.ObjectDiff, error) {
+	target, err := s.clusters.Target(ctx, tenant.GetClusterId())
+	if err != nil {
+		return nil, err
+	}
+	name := constants.ApplicationNameForTenant(tenant.GetId())
+	namespace, err := deploy.PreviewNamespace(ctx, s.deployer, target.Client, tenant.GetId(), deleting)
+	if err != nil {
+		return nil, err
+	}
+	var changes []deploy.Change
+	if deleting {
+		changes, err = s.deployer.PreviewDelete(ctx, name, tenant, target)
+		changes = append(changes, namespace...)
+	} else {
+		changes, err = s.deployer.Preview(ctx, name, tenant, target)
+		changes = append(namespace, changes...)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to preview tenant: %v", err)
+	}
+
+	diff := make([]*v1.ObjectDiff, 0, len(changes))
+	for _, change := range changes {
+		objectDiff, err := diffChange(change)
+		if err != nil {
+			return nil, err
+		}
+		diff = append(diff, objectDiff)
+	}
+	return diff, nil
+}
+
+func diffChange(change deploy.Change) (*v1.ObjectDiff, error) {
+	obj := change.Desired
+	if obj == nil {
+		obj = change.Live
+	}
+	diff := &v1.ObjectDiff{
+		ApiVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+	switch {
+	case change.Live == nil:
+		diff.Action = v1.DiffAction_DIFF_ACTION_CREATE
+	case change.Desired == nil:
+		diff.Action = v1.DiffAction_DIFF_ACTION_DELETE
+	default:
+		var err error
+		if diff.Fields, err = deploy.DiffFields(managedFields(change.Live), managedFields(change.Desired)); err != nil {
+			return nil, err
+		}
+		diff.Action = v1.DiffAction_DIFF_ACTION_UNCHANGED
+		if len(diff.Fields) > 0 {
+			diff.Action = v1.DiffAction_DIFF_ACTION_UPDATE
+		}
+	}
+	if change.Desired != nil {
+		var err error
+		if diff.Desired, err = structpb.NewStruct(change.Desired.Object); err != nil {
+			return nil, err
+		}
+	}
+	return diff, nil
+}
+
+// managedFields drops the fields of an object that the cluster owns, metadata only keeps labels
+func managedFields(obj *unstructured.Unstructured) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for k, v := range obj.Object {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+		default:
+			fields[k] = v
+		}
+	}
+	if labels, ok, _ := unstructured.NestedMap(obj.Object, "metadata", "labels"); ok {
+		fields["metadata"] = map[string]interface{}{"labels": labels}
+	}
+	return fields
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/convert"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+func (s *Server) RenderTenant(ctx context.Context, request *v1.RenderTenantRequest) (*v1.RenderTenantResponse, error) {
+	storedTenant, err := s.store.GetTenantByID(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := convert.TenantFromStore(storedTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	// The tenant source is released under the namespace name, the others under the application name like Argo CD does
+	namespace := constants.NamespaceNameForTenant(tenant.GetId())
+	objects, revision, err := s.charts.Render(ctx, tenant.GetSource(), tenant.GetSources(), namespace, namespace)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to render tenant: %v", err)
+	}
+	for _, source := range tenant.GetSources() {
+		if source.GetPath() == "" && source.GetChart() == nil {
+			continue
+		}
+		sourceObjects, _, err := s.charts.Render(ctx, source, tenant.GetSources(), constants.ApplicationNameForTenant(tenant.GetId()), namespace)
+		if err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "failed to render tenant: %v", err)
+		}
+		objects = append(objects, sourceObjects...)
+	}
+
+	resp := &v1.RenderTenantResponse{Revision: revision}
+	if request.GetFormat() == v1.ManifestFormat_MANIFEST_FORMAT_YAML {
+		if resp.Yaml, err = manifestYaml(objects); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	for _, obj := range objects {
+		o, err := structpb.NewStruct(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		resp.Objects = append(resp.Objects, o)
+	}
+	return resp, nil
+}
+
+// manifestYaml joins objects in a multi-document manifest
+func manifestYaml(objects []*unstructured.Unstructured) (string, error) {
+	documents := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return "", err
+		}
+		documents = append(documents, string(data))
+	}
+	return strings.Join(documents, "---\n"), nil
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"strconv"
+)
+
+func (s *Server) GetTenantResources(ctx context.Context, request *v1.GetTenantResourcesRequest) (*v1.GetTenantResourcesResponse, error) {
+	storedTenant, err := s.store.GetTenantByID(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.clusters.Target(ctx, storedTenant.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := s.deployer.Resources(ctx, constants.ApplicationNameForTenant(storedTenant.ID))
+	if err != nil {
+		return nil, err
+	}
+	namespace := constants.NamespaceNameForTenant(storedTenant.ID)
+	live, err := readLiveStatus(ctx, target.Client, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without an inventory from the backend, the resources of known kinds in the namespace are listed
+	if resources == nil {
+		resources = live.resources
+	}
+	for _, resource := range resources {
+		if resource.GetNamespace() == "" && resource.GetKind() != "Namespace" {
+			resource.Namespace = namespace
+		}
+		if resource.GetNamespace() == namespace {
+			live.apply(resource)
+		}
+	}
+	return &v1.GetTenantResourcesResponse{Resources: resources}, nil
+}
+
+// liveStatus is the status of the objects of known kinds in a namespace, by kind and name
+type liveStatus struct {
+	workloads    map[string]*v1.WorkloadStatus
+	pods         map[string]*v1.PodStatus
+	volumeClaims map[string]*v1.VolumeClaimStatus
+	services     map[string]*v1.ServiceStatus
+	ingresses    map[string]*v1.IngressStatus
+	// resources lists the objects read, Pods owned by workloads left out
+	resources []*v1.TenantResource
+}
+
+// readLiveStatus reads Deployments, StatefulSets, DaemonSets, Pods, PersistentVolumeClaims, Services and Ingresses of a namespace
+func readLiveStatus(ctx context.Context, client kubernetes.Interface, namespace string) (*liveStatus, error) {
+	live := &liveStatus{
+		workloads:    map[string]*v1.WorkloadStatus{},
+		pods:         map[string]*v1.PodStatus{},
+		volumeClaims: map[string]*v1.VolumeClaimStatus{},
+		services:     map[string]*v1.ServiceStatus{},
+		ingresses:    map[string]*v1.IngressStatus{},
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	owned := map[string]bool{}
+	addWorkload := func(kind, name string, selector *metav1.LabelSelector, status *v1.WorkloadStatus) error {
+		podSelector, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods.Items {
+			if !podSelector.Empty() && podSelector.Matches(labels.Set(pod.Labels)) {
+				status.Pods = append(status.Pods, podStatus(pod))
+				owned[pod.Name] = true
+			}
+		}
+		live.workloads[kind+"/"+name] = status
+		live.resources = append(live.resources, &v1.TenantResource{Group: appsv1.GroupName, Version: "v1", Kind: kind, Name: name})
+		return nil
+	}
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, d := range deployments.Items {
+		if err := addWorkload("Deployment", d.Name, d.Spec.Selector, &v1.WorkloadStatus{
+			Replicas:          d.Status.Replicas,
+			ReadyReplicas:     d.Status.ReadyReplicas,
+			UpdatedReplicas:   d.Status.UpdatedReplicas,
+			AvailableReplicas: d.Status.AvailableReplicas,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, st := range statefulSets.Items {
+		if err := addWorkload("StatefulSet", st.Name, st.Spec.Selector, &v1.WorkloadStatus{
+			Replicas:          st.Status.Replicas,
+			ReadyReplicas:     st.Status.ReadyReplicas,
+			UpdatedReplicas:   st.Status.UpdatedReplicas,
+			AvailableReplicas: st.Status.AvailableReplicas,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	daemonSets, err := client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for _, ds := range daemonSets.Items {
+		if err := addWorkload("DaemonSet", ds.Name, ds.Spec.Selector, &v1.WorkloadStatus{
+			Replicas:          ds.Status.DesiredNumberScheduled,
+			ReadyReplicas:     ds.Status.NumberReady,
+			UpdatedReplicas:   ds.Status.UpdatedNumberScheduled,
+			AvailableReplicas: ds.Status.NumberAvailable,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, pod := range pods.Items {
+		live.pods[pod.Name] = podStatus(pod)
+		if !owned[pod.Name] {
+			live.resources = append(live.resources, &v1.TenantResource{Version: "v1", Kind: "Pod", Name: pod.Name})
+		}
+	}
+
+	claims, err := client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	for _, claim := range claims.Items {
+		status := &v1.VolumeClaimStatus{
+			Phase:      string(claim.Status.Phase),
+			VolumeName: claim.Spec.VolumeName,
+		}
+		if claim.Spec.StorageClassName != nil {
+			status.StorageClass = *claim.Spec.StorageClassName
+		}
+		if capacity, ok := claim.Status.Capacity[corev1.ResourceStorage]; ok {
+			status.Capacity = capacity.String()
+		}
+		live.volumeClaims[claim.Name] = status
+		live.resources = append(live.resources, &v1.TenantResource{Version: "v1", Kind: "PersistentVolumeClaim", Name: claim.Name})
+	}
+
+	services, err := client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	endpoints, err := client.CoreV1().Endpoints(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list endpoints: %w", err)
+	}
+	endpointsByName := map[string]corev1.Endpoints{}
+	for _, e := range endpoints.Items {
+		endpointsByName[e.Name] = e
+	}
+	for _, service := range services.Items {
+		status := &v1.ServiceStatus{
+			Type:         string(service.Spec.Type),
+			ClusterIp:    service.Spec.ClusterIP,
+			LoadBalancer: loadBalancerAddresses(service.Status.LoadBalancer.Ingress),
+		}
+		for _, subset := range endpointsByName[service.Name].Subsets {
+			for _, port := range subset.Ports {
+				for _, address := range subset.Addresses {
+					status.Endpoints = append(status.Endpoints, address.IP+":"+strconv.Itoa(int(port.Port)))
+				}
+				for _, address := range subset.NotReadyAddresses {
+					status.NotReadyEndpoints = append(status.NotReadyEndpoints, address.IP+":"+strconv.Itoa(int(port.Port)))
+				}
+			}
+		}
+		live.services[service.Name] = status
+		live.resources = append(live.resources, &v1.TenantResource{Version: "v1", Kind: "Service", Name: service.Name})
+	}
+
+	ingresses, err := client.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	for _, ingress := range ingresses.Items {
+		status := &v1.IngressStatus{}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host != "" {
+				status.Hosts = append(status.Hosts, rule.Host)
+			}
+		}
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			status.LoadBalancer = append(status.LoadBalancer, ingressAddress(lb))
+		}
+		live.ingresses[ingress.Name] = status
+		live.resources = append(live.resources, &v1.TenantResource{Group: networkingv1.GroupName, Version: "v1", Kind: "Ingress", Name: ingress.Name})
+	}
+
+	return live, nil
+}
+
+// apply sets the live status of a resource of a known kind
+func (l *liveStatus) apply(resource *v1.TenantResource) {
+	switch {
+	case resource.GetGroup() == appsv1.GroupName:
+		if status, ok := l.workloads[resource.GetKind()+"/"+resource.GetName()]; ok {
+			resource.Live = &v1.TenantResource_Workload{Workload: status}
+		}
+	case resource.GetGroup() == networkingv1.GroupName && resource.GetKind() == "Ingress":
+		if status, ok := l.ingresses[resource.GetName()]; ok {
+			resource.Live = &v1.TenantResource_Ingress{Ingress: status}
+		}
+	case resource.GetGroup() == "" && resource.GetKind() == "Pod":
+		if status, ok := l.pods[resource.GetName()]; ok {
+			resource.Live = &v1.TenantResource_Pod{Pod: status}
+		}
+	case resource.GetGroup() == "" && resource.GetKind() == "PersistentVolumeClaim":
+		if status, ok := l.volumeClaims[resource.GetName()]; ok {
+			resource.Live = &v1.TenantResource_VolumeClaim{VolumeClaim: status}
+		}
+	case resource.GetGroup() == "" && resource.GetKind() == "Service":
+		if status, ok := l.services[resource.GetName()]; ok {
+			resource.Live = &v1.TenantResource_Service{Service: status}
+		}
+	}
+}
+
+// podStatus summarizes a pod, the reason is the one of the first container that is not running
+func podStatus(pod corev1.Pod) *v1.PodStatus {
+	status := &v1.PodStatus{
+		Name:       pod.Name,
+		Phase:      string(pod.Status.Phase),
+		Containers: int32(len(pod.Spec.Containers)),
+		Reason:     pod.Status.Reason,
+		Message:    pod.Status.Message,
+		Node:       pod.Spec.NodeName,
+	}
+	containerStatuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for i, c := range containerStatuses {
+		if i >= len(pod.Status.InitContainerStatuses) && c.Ready {
+			status.ReadyContainers++
+		}
+		status.Restarts += c.RestartCount
+		if status.Reason != "" {
+			continue
+		}
+		if waiting := c.State.Waiting; waiting != nil && waiting.Reason != "" {
+			status.Reason, status.Message = waiting.Reason, waiting.Message
+		} else if terminated := c.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			status.Reason, status.Message = terminated.Reason, terminated.Message
+		}
+	}
+	return status
+}
+
+func loadBalancerAddresses(ingresses []corev1.LoadBalancerIngress) []string {
+	var addresses []string
+	for _, lb := range ingresses {
+		if lb.Hostname != "" {
+			addresses = append(addresses, lb.Hostname)
+		} else if lb.IP != "" {
+			addresses = append(addresses, lb.IP)
+		}
+	}
+	return addresses
+}
+
+func ingressAddress(lb networkingv1.IngressLoadBalancerIngress) string {
+	if lb.Hostname != "" {
+		return lb.Hostname
+	}
+	return lb.IP
+}
@@ -2,66 +2,99 @@ package server
 
 import (
 	"context"
-	"fmt"
-	"github.com/jackc/pgx/v5"
+	"encoding/json"
+	"errors"
 	"github.com/rs/xid"
-	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
-	"k8s.io/client-go/informers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 	"k8s.io/client-go/kubernetes"
+	"net/url"
+	"path/filepath"
 	v1 "poc-cloud-service/gen/api/v1"
-	"poc-cloud-service/internal/argocd"
+	"poc-cloud-service/internal/charts"
+	"poc-cloud-service/internal/cluster"
 	"poc-cloud-service/internal/constants"
 	"poc-cloud-service/internal/convert"
+	"poc-cloud-service/internal/deploy"
+	"poc-cloud-service/internal/secrets"
 	"poc-cloud-service/internal/store"
-	"poc-cloud-service/log"
-	"time"
+	"regexp"
+	"slices"
+	"strings"
 )
 
 type Server struct {
 	v1.UnimplementedTenantServiceServer
 	client   kubernetes.Interface
-	db       *pgx.Conn
+	db       *store.Transactor
 	store    *store.Queries
-	informer informers.GenericInformer
+	deployer deploy.Deployer
+	secrets  *secrets.Envelope
+	charts   *charts.Fetcher
+	clusters *cluster.Registry
 }
 
-func NewServer(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface, store *store.Queries) (*Server, error) {
-	l := log.FromContext(ctx)
-	factory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, time.Hour)
-	informer := factory.ForResource(constants.ArgoApplicationsGVR)
-
-	l.Info("starting informer")
-	go func() {
-		informer.Informer().Run(ctx.Done())
-	}()
-
-	l.Info("waiting for cache sync")
-	factory.WaitForCacheSync(ctx.Done())
-
-	l.Info("cache sync done")
+func NewServer(ctx context.Context, client kubernetes.Interface, deployer deploy.Deployer, store *store.Queries, db *store.Transactor, secrets *secrets.Envelope, fetcher *charts.Fetcher, clusters *cluster.Registry) (*Server, error) {
 	return &Server{
 		client:   client,
+		db:       db,
 		store:    store,
-		informer: informer,
+		deployer: deployer,
+		secrets:  secrets,
+		charts:   fetcher,
+		clusters: clusters,
 	}, nil
 }
 
 func (s *Server) CreateTenant(ctx context.Context, request *v1.CreateTenantRequest) (*v1.CreateTenantResponse, error) {
-	id := xid.New().String()
-	valuesJson, err := request.GetSource().GetHelm().GetValues().MarshalJSON()
+	if err := validateSources(request.GetSource(), request.GetSources()); err != nil {
+		return nil, err
+	}
+	if err := s.checkPlan(ctx, request.GetPlanId()); err != nil {
+		return nil, err
+	}
+	if err := s.validateValues(ctx, request.GetSource(), request.GetSources(), request.GetPlanId()); err != nil {
+		return nil, err
+	}
+	if err := validateSyncPolicy(request.GetSyncPolicy()); err != nil {
+		return nil, err
+	}
+	syncPolicy := request.GetSyncPolicy()
+	if syncPolicy == nil {
+		planSyncPolicy, err := s.planSyncPolicy(ctx, request.GetPlanId())
+		if err != nil {
+			return nil, err
+		}
+		syncPolicy = planSyncPolicy
+	}
+	secretValues, err := s.sealSecretValues(ctx, request.GetSource().GetHelm().GetSecretValues())
 	if err != nil {
 		return nil, err
 	}
-	created, err := s.store.CreateTenant(ctx, store.CreateTenantParams{
-		ID:             id,
-		RepoUrl:        request.GetSource().RepoUrl,
-		Path:           request.GetSource().GetPath(),
-		Values:         valuesJson,
-		TargetRevision: request.GetSource().GetTargetRevision(),
-	})
+	clusterID, err := s.schedule(ctx, request.GetPlacement())
+	if err != nil {
+		return nil, err
+	}
+	tenant := &v1.Tenant{
+		Id:         xid.New().String(),
+		Source:     request.GetSource(),
+		Placement:  request.GetPlacement(),
+		ClusterId:  clusterID,
+		Sources:    request.GetSources(),
+		PlanId:     request.GetPlanId(),
+		SyncPolicy: syncPolicy,
+	}
+	if request.GetValidateOnly() {
+		resp := &v1.CreateTenantResponse{}
+		if resp.Diff, err = s.preview(ctx, tenant, false); err != nil {
+			return nil, err
+		}
+		resp.Tenant = withoutSecretValues(tenant)
+		return resp, nil
+	}
+	created, err := s.insertTenant(ctx, tenant, secretValues)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +106,54 @@ func (s *Server) CreateTenant(ctx context.Context, request *v1.CreateTenantReque
 	return resp, nil
 }
 
+// insertTenant stores a new tenant, secretValues being its sealed secret values.
+// The cluster it is placed on is locked until the tenant is stored, so that it cannot be filled or deleted meanwhile.
+func (s *Server) insertTenant(ctx context.Context, tenant *v1.Tenant, secretValues []byte) (store.Tenant, error) {
+	source, err := convert.SourceToStore(tenant.GetSource(), tenant.GetSources())
+	if err != nil {
+		return store.Tenant{}, err
+	}
+	clusterSelectorJson, err := json.Marshal(tenant.GetPlacement().GetClusterSelector())
+	if err != nil {
+		return store.Tenant{}, err
+	}
+	syncPolicyJson, err := convert.SyncPolicyToStore(tenant.GetSyncPolicy())
+	if err != nil {
+		return store.Tenant{}, err
+	}
+	var created store.Tenant
+	err = s.db.InTx(ctx, func(q *store.Queries) error {
+		if err := lockClusterCapacity(ctx, q, tenant.GetClusterId()); err != nil {
+			return err
+		}
+		created, err = q.CreateTenant(ctx, store.CreateTenantParams{
+			ID:              tenant.GetId(),
+			RepoUrl:         source.RepoUrl,
+			Path:            source.Path,
+			Values:          source.Values,
+			TargetRevision:  source.TargetRevision,
+			ClusterID:       tenant.GetClusterId(),
+			ClusterSelector: clusterSelectorJson,
+			ChartRepoUrl:    source.ChartRepoUrl,
+			ChartName:       source.ChartName,
+			ChartVersion:    source.ChartVersion,
+			ValueFiles:      source.ValueFiles,
+			Parameters:      source.Parameters,
+			FileParameters:  source.FileParameters,
+			Ref:             source.Ref,
+			Sources:         source.Sources,
+			SourceType:      source.SourceType,
+			Kustomize:       source.Kustomize,
+			Directory:       source.Directory,
+			SecretValues:    secretValues,
+			PlanID:          tenant.GetPlanId(),
+			SyncPolicy:      syncPolicyJson,
+		})
+		return err
+	})
+	return created, err
+}
+
 func (s *Server) GetTenant(ctx context.Context, request *v1.GetTenantRequest) (*v1.GetTenantResponse, error) {
 	storedTenant, err := s.store.GetTenantByID(ctx, request.GetId())
 	if err != nil {
@@ -85,7 +166,7 @@ func (s *Server) GetTenant(ctx context.Context, request *v1.GetTenantRequest) (*
 		return nil, err
 	}
 
-	if err := s.withApplication(resp.Tenant); err != nil {
+	if err := s.withApplication(ctx, resp.Tenant); err != nil {
 		return nil, err
 	}
 
@@ -107,7 +188,7 @@ func (s *Server) ListTenants(ctx context.Context, request *v1.ListTenantsRequest
 		if err != nil {
 			return nil, err
 		}
-		if err := s.withApplication(tenant); err != nil {
+		if err := s.withApplication(ctx, tenant); err != nil {
 			return nil, err
 		}
 		resp.Tenants = append(resp.Tenants, tenant)
@@ -117,21 +198,69 @@ func (s *Server) ListTenants(ctx context.Context, request *v1.ListTenantsRequest
 }
 
 func (s *Server) UpdateTenant(ctx context.Context, request *v1.UpdateTenantRequest) (*v1.UpdateTenantResponse, error) {
-	_, err := s.store.GetTenantByID(ctx, request.GetId())
+	if err := validateSources(request.GetSource(), request.GetSources()); err != nil {
+		return nil, err
+	}
+	existing, err := s.store.GetTenantByID(ctx, request.GetId())
 	if err != nil {
 		return nil, err
 	}
-	valuesJson, err := request.GetSource().GetHelm().GetValues().MarshalJSON()
+	// A move deploys the tenant as it was when it started, an update would not reach the target
+	if err := s.ensureNoActiveOperation(ctx, existing.ID); err != nil {
+		return nil, err
+	}
+	source := request.GetSource()
+	if source.GetHelm().GetSecretValues() == nil && len(existing.SecretValues) > 0 {
+		// The current secret values are validated along with the new values
+		source = proto.Clone(source).(*v1.Source)
+		if source.Helm == nil {
+			source.Helm = &v1.Helm{}
+		}
+		if source.Helm.SecretValues, err = s.secrets.OpenValues(ctx, existing.SecretValues); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.validateValues(ctx, source, request.GetSources(), existing.PlanID); err != nil {
+		return nil, err
+	}
+	if err := validateSyncPolicy(request.GetSyncPolicy()); err != nil {
+		return nil, err
+	}
+	params, err := convert.SourceToStore(request.GetSource(), request.GetSources())
 	if err != nil {
 		return nil, err
 	}
-	updated, err := s.store.UpdateTenant(ctx, store.UpdateTenantParams{
-		ID:             request.Id,
-		RepoUrl:        request.GetSource().GetRepoUrl(),
-		Path:           request.GetSource().GetPath(),
-		Values:         valuesJson,
-		TargetRevision: request.GetSource().GetTargetRevision(),
-	})
+	if request.GetValidateOnly() {
+		tenant, err := convert.TenantFromStore(existing)
+		if err != nil {
+			return nil, err
+		}
+		tenant.Source = source
+		tenant.Sources = request.GetSources()
+		if request.GetSyncPolicy() != nil {
+			tenant.SyncPolicy = request.GetSyncPolicy()
+		}
+		resp := &v1.UpdateTenantResponse{}
+		if resp.Diff, err = s.preview(ctx, tenant, false); err != nil {
+			return nil, err
+		}
+		resp.Tenant = withoutSecretValues(tenant)
+		return resp, nil
+	}
+	params.ID = request.GetId()
+	params.SecretValues = existing.SecretValues
+	params.SyncPolicy = existing.SyncPolicy
+	if request.GetSyncPolicy() != nil {
+		if params.SyncPolicy, err = convert.SyncPolicyToStore(request.GetSyncPolicy()); err != nil {
+			return nil, err
+		}
+	}
+	if secretValues := request.GetSource().GetHelm().GetSecretValues(); secretValues != nil {
+		if params.SecretValues, err = s.sealSecretValues(ctx, secretValues); err != nil {
+			return nil, err
+		}
+	}
+	updated, err := s.store.UpdateTenant(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +273,23 @@ func (s *Server) UpdateTenant(ctx context.Context, request *v1.UpdateTenantReque
 }
 
 func (s *Server) DeleteTenant(ctx context.Context, request *v1.DeleteTenantRequest) (*v1.DeleteTenantResponse, error) {
+	if err := s.ensureNoActiveOperation(ctx, request.GetId()); err != nil {
+		return nil, err
+	}
+	if request.GetValidateOnly() {
+		existing, err := s.store.GetTenantByID(ctx, request.GetId())
+		if err != nil {
+			return nil, err
+		}
+		resp := &v1.DeleteTenantResponse{}
+		if resp.Tenant, err = convert.TenantFromStore(existing); err != nil {
+			return nil, err
+		}
+		if resp.Diff, err = s.preview(ctx, resp.Tenant, true); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
 	deleted, err := s.store.DeleteTenant(ctx, request.GetId())
 	if err != nil {
 		return nil, err
@@ -156,37 +302,152 @@ func (s *Server) DeleteTenant(ctx context.Context, request *v1.DeleteTenantReque
 	return resp, nil
 }
 
-func (s *Server) withApplication(tenant *v1.Tenant) error {
-	app, err := s.getApplication(tenant.GetId())
+func (s *Server) withApplication(ctx context.Context, tenant *v1.Tenant) error {
+	app, err := s.deployer.Observe(ctx, constants.ApplicationNameForTenant(tenant.GetId()))
 	if err != nil {
 		return err
 	}
-	if app == nil {
-		return nil
+	tenant.Application = app
+	return nil
+}
+
+// withoutSecretValues returns a copy of a tenant that is not persisted, without the secret values of its request
+func withoutSecretValues(tenant *v1.Tenant) *v1.Tenant {
+	tenant = proto.Clone(tenant).(*v1.Tenant)
+	if tenant.GetSource().GetHelm() != nil {
+		tenant.Source.Helm.SecretValues = nil
+	}
+	return tenant
+}
+
+// sealSecretValues encrypts the secret values of a request before they are stored
+func (s *Server) sealSecretValues(ctx context.Context, values *structpb.Struct) ([]byte, error) {
+	sealed, err := s.secrets.SealValues(ctx, values)
+	if errors.Is(err, secrets.ErrNotConfigured) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return sealed, err
+}
+
+// validateSources checks every source of a tenant, and that value files only reference named sources
+func validateSources(source *v1.Source, sources []*v1.Source) error {
+	for _, src := range sources {
+		// Secret values are sealed and delivered for the tenant source only
+		if src.GetHelm().GetSecretValues() != nil {
+			return status.Error(codes.InvalidArgument, "secret_values are only accepted on the tenant source")
+		}
+	}
+	refs := map[string]bool{}
+	for _, src := range append([]*v1.Source{source}, sources...) {
+		if err := validateSource(src); err != nil {
+			return err
+		}
+		if ref := src.GetRef(); ref != "" {
+			if refs[ref] {
+				return status.Errorf(codes.InvalidArgument, "source ref %q is used twice", ref)
+			}
+			refs[ref] = true
+		}
 	}
-	tenant.Application = &v1.Application{
-		Health: &v1.Health{
-			Status:  app.Status.Health.Status,
-			Message: app.Status.Health.Message,
-		},
+	for _, src := range append([]*v1.Source{source}, sources...) {
+		for _, valueFile := range src.GetHelm().GetValueFiles() {
+			if ref, _, ok := charts.ValueFileRef(valueFile); ok && !refs[ref] {
+				return status.Errorf(codes.InvalidArgument, "value file %q references unknown source %q", valueFile, ref)
+			}
+		}
+		for _, parameter := range src.GetHelm().GetParameters() {
+			if parameter.GetName() == "" {
+				return status.Error(codes.InvalidArgument, "helm parameter name is required")
+			}
+		}
+		for _, parameter := range src.GetHelm().GetFileParameters() {
+			if parameter.GetName() == "" || parameter.GetPath() == "" {
+				return status.Error(codes.InvalidArgument, "helm file parameter name and path are required")
+			}
+		}
 	}
 	return nil
 }
 
-func (s *Server) getApplication(tenantID string) (*argocd.Application, error) {
-	obj, err := s.informer.Lister().Get(fmt.Sprintf("%s/%s",
-		constants.OpenshiftGitopsNamespace,
-		constants.ApplicationNameForTenant(tenantID),
-	))
-	if err != nil {
-		if !errors.IsNotFound(err) {
-			return nil, err
+// validateSource checks that a source is either a Git source or a chart source, and only sets the options of its type
+func validateSource(source *v1.Source) error {
+	if err := validateSourceType(source); err != nil {
+		return err
+	}
+	chart := source.GetChart()
+	if chart == nil {
+		if err := validateRemoteURL(source.GetRepoUrl(), "http", "https", "ssh", "git"); err != nil {
+			return err
 		}
-		return nil, nil
+		if path := source.GetPath(); path != "" && !filepath.IsLocal(path) {
+			return status.Errorf(codes.InvalidArgument, "path %q is outside of the repository", path)
+		}
+		return nil
+	}
+	if source.GetRepoUrl() != "" || source.GetPath() != "" || source.GetTargetRevision() != "" {
+		return status.Error(codes.InvalidArgument, "source must set either repo_url, path and target_revision or chart, not both")
+	}
+	if chart.GetRepoUrl() == "" {
+		return status.Error(codes.InvalidArgument, "chart repo_url is required")
 	}
-	unstruct, ok := obj.(*unstructured.Unstructured)
-	if !ok {
-		return nil, fmt.Errorf("unexpected object type: %T", obj)
+	if chart.GetName() == "" {
+		return status.Error(codes.InvalidArgument, "chart name is required")
+	}
+	return validateRemoteURL(chart.GetRepoUrl(), "http", "https", "oci")
+}
+
+// scpURLRegexp matches the user@host:path form of ssh urls
+var scpURLRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+@[A-Za-z0-9_.-]+:`)
+
+// validateRemoteURL rejects repository urls that are not served by a remote host, local paths and file:// urls
+// would let a tenant read the files of the service
+func validateRemoteURL(repoURL string, schemes ...string) error {
+	if repoURL == "" {
+		return nil
+	}
+	if slices.Contains(schemes, "ssh") && scpURLRegexp.MatchString(repoURL) {
+		return nil
 	}
-	return argocd.FromUnstructured(unstruct)
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" || !slices.Contains(schemes, u.Scheme) {
+		return status.Errorf(codes.InvalidArgument, "repo_url %q must be a %s url", repoURL, strings.Join(schemes, ", "))
+	}
+	return nil
+}
+
+// hasHelmOptions is false for an empty helm message, which tenants read from the store always have
+func hasHelmOptions(helm *v1.Helm) bool {
+	return len(helm.GetValues().GetFields()) > 0 || len(helm.GetValueFiles()) > 0 ||
+		len(helm.GetParameters()) > 0 || len(helm.GetFileParameters()) > 0 || len(helm.GetSecretValues().GetFields()) > 0
+}
+
+func validateSourceType(source *v1.Source) error {
+	switch source.GetType() {
+	case v1.SourceType_SOURCE_TYPE_UNSPECIFIED, v1.SourceType_SOURCE_TYPE_HELM:
+		if source.GetKustomize() != nil || source.GetDirectory() != nil {
+			return status.Error(codes.InvalidArgument, "kustomize and directory options require a source of that type")
+		}
+	case v1.SourceType_SOURCE_TYPE_KUSTOMIZE:
+		if source.GetChart() != nil {
+			return status.Error(codes.InvalidArgument, "a chart source must be of type helm")
+		}
+		if hasHelmOptions(source.GetHelm()) || source.GetDirectory() != nil {
+			return status.Error(codes.InvalidArgument, "a kustomize source only accepts kustomize options")
+		}
+		for _, patch := range source.GetKustomize().GetPatches() {
+			if (patch.GetPatch() == "") == (patch.GetPath() == "") {
+				return status.Error(codes.InvalidArgument, "a kustomize patch must set either patch or path")
+			}
+		}
+	case v1.SourceType_SOURCE_TYPE_DIRECTORY:
+		if source.GetChart() != nil {
+			return status.Error(codes.InvalidArgument, "a chart source must be of type helm")
+		}
+		if hasHelmOptions(source.GetHelm()) || source.GetKustomize() != nil {
+			return status.Error(codes.InvalidArgument, "a directory source only accepts directory options")
+		}
+	default:
+		return status.Errorf(codes.InvalidArgument, "unknown source type %s", source.GetType())
+	}
+	return nil
 }
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	v1 "poc-cloud-service/gen/api/v1"
+	"testing"
+)
+
+func TestValidateSourcesRepoURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		source *v1.Source
+		valid  bool
+	}{
+		{"default repository", &v1.Source{}, true},
+		{"https", &v1.Source{RepoUrl: "https://github.com/org/repo"}, true},
+		{"ssh", &v1.Source{RepoUrl: "ssh://git@github.com/org/repo.git"}, true},
+		{"scp", &v1.Source{RepoUrl: "git@github.com:org/repo.git"}, true},
+		{"file url", &v1.Source{RepoUrl: "file:///etc"}, false},
+		{"absolute path", &v1.Source{RepoUrl: "/var/lib"}, false},
+		{"relative path", &v1.Source{RepoUrl: "../repo"}, false},
+		{"path outside of the repository", &v1.Source{RepoUrl: "https://github.com/org/repo", Path: "../../etc"}, false},
+		{"chart repository", &v1.Source{Kind: &v1.Source_Chart{Chart: &v1.ChartSource{RepoUrl: "https://charts.example.com", Name: "app"}}}, true},
+		{"oci registry", &v1.Source{Kind: &v1.Source_Chart{Chart: &v1.ChartSource{RepoUrl: "oci://registry.example.com/charts", Name: "app"}}}, true},
+		{"local chart repository", &v1.Source{Kind: &v1.Source_Chart{Chart: &v1.ChartSource{RepoUrl: "file:///charts", Name: "app"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSources(tt.source, nil)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.valid && status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("expected InvalidArgument, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateSourcesSecretValues(t *testing.T) {
+	secretValues := &structpb.Struct{Fields: map[string]*structpb.Value{"password": structpb.NewStringValue("hunter2")}}
+	source := &v1.Source{Helm: &v1.Helm{SecretValues: secretValues}}
+	if err := validateSources(source, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	extra := &v1.Source{RepoUrl: "https://github.com/org/values", Ref: "values", Helm: &v1.Helm{SecretValues: secretValues}}
+	if err := validateSources(&v1.Source{}, []*v1.Source{extra}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestUpdateTenantDuringOperation(t *testing.T) {
+	db := &fakeDB{operation: "op1"}
+	_, err := newFakeServer(db).UpdateTenant(context.Background(), &v1.UpdateTenantRequest{Id: "t1", Source: &v1.Source{}})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+	if len(db.writes) > 0 {
+		t.Fatalf("expected the tenant to be left as it is, got writes %v", db.writes)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/convert"
+	"poc-cloud-service/internal/store"
+)
+
+// SuspendTenant stops the deployer from syncing a tenant, the reconciler scales its workloads to zero when scale_down is set
+func (s *Server) SuspendTenant(ctx context.Context, request *v1.SuspendTenantRequest) (*v1.SuspendTenantResponse, error) {
+	storedTenant, err := s.store.SetTenantSuspended(ctx, store.SetTenantSuspendedParams{
+		ID:        request.GetId(),
+		Suspended: true,
+		ScaleDown: request.GetScaleDown(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := convert.TenantFromStore(storedTenant)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.SuspendTenantResponse{Tenant: tenant}, nil
+}
+
+// ResumeTenant syncs a suspended tenant again, the replicas recorded when it was scaled down are restored
+func (s *Server) ResumeTenant(ctx context.Context, request *v1.ResumeTenantRequest) (*v1.ResumeTenantResponse, error) {
+	storedTenant, err := s.store.SetTenantSuspended(ctx, store.SetTenantSuspendedParams{
+		ID: request.GetId(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := convert.TenantFromStore(storedTenant)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ResumeTenantResponse{Tenant: tenant}, nil
+}
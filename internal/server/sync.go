@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/constants"
+	"poc-cloud-service/internal/deploy"
+)
+
+func (s *Server) SyncTenant(ctx context.Context, request *v1.SyncTenantRequest) (*v1.SyncTenantResponse, error) {
+	if _, err := s.store.GetTenantByID(ctx, request.GetId()); err != nil {
+		return nil, err
+	}
+	app, err := s.deployer.Sync(ctx, constants.ApplicationNameForTenant(request.GetId()), deploy.SyncOptions{
+		Prune:     request.GetPrune(),
+		Force:     request.GetForce(),
+		DryRun:    request.GetDryRun(),
+		Resources: request.GetResources(),
+	})
+	if err != nil {
+		return nil, deployError(err)
+	}
+	return &v1.SyncTenantResponse{Application: app}, nil
+}
+
+func (s *Server) RefreshTenant(ctx context.Context, request *v1.RefreshTenantRequest) (*v1.RefreshTenantResponse, error) {
+	if _, err := s.store.GetTenantByID(ctx, request.GetId()); err != nil {
+		return nil, err
+	}
+	hard := request.GetType() == v1.RefreshType_REFRESH_TYPE_HARD
+	app, err := s.deployer.Refresh(ctx, constants.ApplicationNameForTenant(request.GetId()), hard)
+	if err != nil {
+		return nil, deployError(err)
+	}
+	return &v1.RefreshTenantResponse{Application: app}, nil
+}
+
+func (s *Server) TerminateTenantOperation(ctx context.Context, request *v1.TerminateTenantOperationRequest) (*v1.TerminateTenantOperationResponse, error) {
+	if _, err := s.store.GetTenantByID(ctx, request.GetId()); err != nil {
+		return nil, err
+	}
+	app, err := s.deployer.TerminateOperation(ctx, constants.ApplicationNameForTenant(request.GetId()))
+	if err != nil {
+		return nil, deployError(err)
+	}
+	return &v1.TerminateTenantOperationResponse{Application: app}, nil
+}
+
+// deployError maps the errors of deployer operations to status codes
+func deployError(err error) error {
+	switch {
+	case errors.Is(err, deploy.ErrNotFound):
+		return status.Error(codes.NotFound, "the tenant is not deployed yet")
+	case errors.Is(err, deploy.ErrUnsupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, deploy.ErrOperationInProgress), errors.Is(err, deploy.ErrNoOperation):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return err
+	}
+}
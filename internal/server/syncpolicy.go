@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/convert"
+	"strings"
+	"time"
+)
+
+// validateSyncPolicy checks the sync options and retry backoff of a sync policy
+func validateSyncPolicy(policy *v1.SyncPolicy) error {
+	for _, option := range policy.GetSyncOptions() {
+		if key, value, ok := strings.Cut(option, "="); !ok || key == "" || value == "" {
+			return status.Errorf(codes.InvalidArgument, "sync option %q is not of the form Key=value", option)
+		}
+	}
+	retry := policy.GetRetry()
+	for _, d := range []string{retry.GetBackoffDuration(), retry.GetBackoffMaxDuration()} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid retry backoff duration %q: %v", d, err)
+		}
+	}
+	if retry.GetBackoffFactor() < 0 {
+		return status.Error(codes.InvalidArgument, "retry backoff factor must not be negative")
+	}
+	return nil
+}
+
+// planSyncPolicy returns the sync policy of a plan, used for tenants created without one
+func (s *Server) planSyncPolicy(ctx context.Context, planID string) (*v1.SyncPolicy, error) {
+	if planID == "" {
+		return nil, nil
+	}
+	storedPlan, err := s.store.GetPlanByID(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := convert.PlanFromStore(storedPlan)
+	if err != nil {
+		return nil, err
+	}
+	return plan.GetSyncPolicy(), nil
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"helm.sh/helm/v3/pkg/chartutil"
+	v1 "poc-cloud-service/gen/api/v1"
+	"poc-cloud-service/internal/charts"
+	"strings"
+)
+
+// validateValues renders the values of a helm source and validates them against the values.schema.json of its chart,
+// or the values schema of the plan when the chart does not ship one
+func (s *Server) validateValues(ctx context.Context, source *v1.Source, sources []*v1.Source, planID string) error {
+	if source.GetType() != v1.SourceType_SOURCE_TYPE_UNSPECIFIED && source.GetType() != v1.SourceType_SOURCE_TYPE_HELM {
+		return nil
+	}
+	c, err := s.charts.Load(ctx, source)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to load chart: %v", err)
+	}
+
+	schema := c.Schema
+	if len(schema) == 0 && planID != "" {
+		plan, err := s.store.GetPlanByID(ctx, planID)
+		if err != nil {
+			return err
+		}
+		if string(plan.ValuesSchema) != "{}" {
+			schema = plan.ValuesSchema
+		}
+	}
+	if len(schema) == 0 {
+		return nil
+	}
+
+	values, err := s.charts.Values(ctx, source, sources, c.Chart)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	// Validate what the chart is rendered with, its defaults included
+	values, err = chartutil.CoalesceValues(c.Chart, values)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to merge values: %v", err)
+	}
+	violations, err := charts.ValidateValues(schema, values)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		field := violation.Pointer
+		if field == "" {
+			field = "/"
+		}
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: violation.Message,
+		})
+		messages[i] = fmt.Sprintf("%s: %s", field, violation.Message)
+	}
+	st, err := status.New(codes.InvalidArgument, "invalid helm values: "+strings.Join(messages, "; ")).WithDetails(badRequest)
+	if err != nil {
+		return err
+	}
+	return st.Err()
+}
+
+// checkPlan returns InvalidArgument when a tenant subscribes to a plan that does not exist
+func (s *Server) checkPlan(ctx context.Context, planID string) error {
+	if planID == "" {
+		return nil
+	}
+	if _, err := s.store.GetPlanByID(ctx, planID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return status.Errorf(codes.InvalidArgument, "plan %s not found", planID)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package store
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the PostgreSQL error code of a statement rejected by a unique index
+const uniqueViolation = "23505"
+
+// ActiveOperationIndex is the unique index allowing a single operation in progress per tenant
+const ActiveOperationIndex = "operations_active_tenant_id"
+
+// IsUniqueViolation reports whether err was raised by the unique index or constraint with the given name
+func IsUniqueViolation(err error, name string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == name
+}
@@ -9,6 +9,7 @@ import (
 	pgxDriver "github.com/golang-migrate/migrate/v4/database/pgx/v5"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"io/fs"
 )
 
 //go:embed migrations/*.sql
@@ -43,3 +44,36 @@ func Migrate(ctx context.Context, connString string) error {
 	return nil
 
 }
+
+// LatestMigration returns the version of the last embedded migration, which Migrate brings the database to
+func LatestMigration() (uint, error) {
+	src, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// MigrationVersion returns the version the database was migrated to, dirty if the last migration failed
+func MigrationVersion(ctx context.Context, db DBTX) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	if err := db.QueryRow(ctx, "select version, dirty from schema_migrations limit 1").Scan(&version, &dirty); err != nil {
+		return 0, false, err
+	}
+	return uint(version), dirty, nil
+}
@@ -0,0 +1,13 @@
+create table clusters
+(
+    id                text primary key,
+    name              text    not null unique,
+    server            text    not null,
+    region            text    not null default '',
+    labels            jsonb   not null default '{}',
+    capacity          integer not null default 0,
+    kubeconfig_secret text    not null default ''
+);
+
+alter table tenants add column cluster_id text not null default '';
+alter table tenants add column cluster_selector jsonb not null default '{}';
\ No newline at end of file
@@ -0,0 +1,13 @@
+create table operations
+(
+    id                text primary key,
+    tenant_id         text        not null,
+    type              text        not null,
+    state             text        not null,
+    source_cluster_id text        not null,
+    target_cluster_id text        not null,
+    message           text        not null default '',
+    created_at        timestamptz not null default now(),
+    updated_at        timestamptz not null default now(),
+    deadline          timestamptz not null
+);
\ No newline at end of file
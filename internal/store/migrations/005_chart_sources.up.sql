@@ -0,0 +1,3 @@
+alter table tenants add column chart_repo_url text not null default '';
+alter table tenants add column chart_name text not null default '';
+alter table tenants add column chart_version text not null default '';
@@ -0,0 +1,5 @@
+alter table tenants add column value_files jsonb not null default '[]';
+alter table tenants add column parameters jsonb not null default '[]';
+alter table tenants add column file_parameters jsonb not null default '[]';
+alter table tenants add column ref text not null default '';
+alter table tenants add column sources jsonb not null default '[]';
@@ -0,0 +1,3 @@
+alter table tenants add column source_type text not null default '';
+alter table tenants add column kustomize jsonb not null default '{}';
+alter table tenants add column directory jsonb not null default '{}';
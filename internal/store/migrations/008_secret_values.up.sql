@@ -0,0 +1 @@
+alter table tenants add column secret_values bytea;
@@ -0,0 +1,8 @@
+create table plans
+(
+    id            text primary key,
+    name          text  not null unique,
+    values_schema jsonb not null default '{}'
+);
+
+alter table tenants add column plan_id text not null default '';
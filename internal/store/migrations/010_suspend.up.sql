@@ -0,0 +1,4 @@
+alter table tenants add column suspended boolean not null default false;
+alter table tenants add column scale_down boolean not null default false;
+-- replicas of the workloads scaled down on suspension, by kind/name, restored on resume
+alter table tenants add column suspended_replicas jsonb not null default '{}';
@@ -0,0 +1,2 @@
+alter table tenants add column sync_policy jsonb not null default '{}';
+alter table plans add column sync_policy jsonb not null default '{}';
@@ -0,0 +1,19 @@
+create table tenant_events
+(
+    id          text primary key,
+    tenant_id   text        not null,
+    reason      text        not null,
+    message     text        not null default '',
+    api_version text        not null,
+    kind        text        not null,
+    namespace   text        not null,
+    name        text        not null,
+    fields      jsonb       not null default '[]',
+    created_at  timestamptz not null default now()
+);
+
+create index tenant_events_tenant_id on tenant_events (tenant_id, created_at);
+
+alter table tenants add column drift_count bigint not null default 0;
+-- last_drift is the latest drift event of the tenant
+alter table tenants add column last_drift jsonb not null default '{}';
@@ -0,0 +1,2 @@
+-- conditions are the metav1.Condition list maintained by the reconciler
+alter table tenants add column conditions jsonb not null default '[]';
@@ -0,0 +1,4 @@
+-- a tenant has at most one operation in progress, the states match constants.ActiveOperationStates
+create unique index operations_active_tenant_id on operations (tenant_id)
+    where state in ('OPERATION_STATE_PROVISIONING', 'OPERATION_STATE_WAITING', 'OPERATION_STATE_CLEANING_UP',
+                    'OPERATION_STATE_ROLLING_BACK');
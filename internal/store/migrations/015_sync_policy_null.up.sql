@@ -0,0 +1,6 @@
+-- an unset sync policy is NULL, '{}' is an explicit empty policy which disables automated sync
+alter table tenants alter column sync_policy drop not null, alter column sync_policy drop default;
+alter table plans alter column sync_policy drop not null, alter column sync_policy drop default;
+-- '{}' was written for unset policies until now
+update tenants set sync_policy = null where sync_policy = '{}';
+update plans set sync_policy = null where sync_policy = '{}';
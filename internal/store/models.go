@@ -4,10 +4,79 @@
 
 package store
 
+import (
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Cluster struct {
+	ID               string
+	Name             string
+	Server           string
+	Region           string
+	Labels           []byte
+	Capacity         int32
+	KubeconfigSecret string
+}
+
+type Operation struct {
+	ID              string
+	TenantID        string
+	Type            string
+	State           string
+	SourceClusterID string
+	TargetClusterID string
+	Message         string
+	CreatedAt       pgtype.Timestamptz
+	UpdatedAt       pgtype.Timestamptz
+	Deadline        pgtype.Timestamptz
+}
+
+type Plan struct {
+	ID           string
+	Name         string
+	ValuesSchema []byte
+	SyncPolicy   []byte
+}
+
+type TenantEvent struct {
+	ID         string
+	TenantID   string
+	Reason     string
+	Message    string
+	ApiVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Fields     []byte
+	CreatedAt  pgtype.Timestamptz
+}
+
 type Tenant struct {
-	ID             string
-	RepoUrl        string
-	Path           string
-	Values         []byte
-	TargetRevision string
+	ID                string
+	RepoUrl           string
+	Path              string
+	Values            []byte
+	TargetRevision    string
+	ClusterID         string
+	ClusterSelector   []byte
+	ChartRepoUrl      string
+	ChartName         string
+	ChartVersion      string
+	ValueFiles        []byte
+	Parameters        []byte
+	FileParameters    []byte
+	Ref               string
+	Sources           []byte
+	SourceType        string
+	Kustomize         []byte
+	Directory         []byte
+	SecretValues      []byte
+	PlanID            string
+	Suspended         bool
+	ScaleDown         bool
+	SuspendedReplicas []byte
+	SyncPolicy        []byte
+	DriftCount        int64
+	LastDrift         []byte
+	Conditions        []byte
 }
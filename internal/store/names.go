@@ -0,0 +1,14 @@
+package store
+
+import "strings"
+
+// QueryName returns the name of a generated query from its "-- name: GetTenant :one" header, other for other statements
+func QueryName(sql string) string {
+	header, _, _ := strings.Cut(sql, "\n")
+	name, ok := strings.CutPrefix(header, "-- name: ")
+	if !ok {
+		return "other"
+	}
+	name, _, _ = strings.Cut(name, " ")
+	return name
+}
@@ -7,20 +7,228 @@ package store
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countActiveOperationsToCluster = `-- name: CountActiveOperationsToCluster :one
+select count(*) from operations
+where target_cluster_id = $1 and state = any($2::text[])
+`
+
+type CountActiveOperationsToClusterParams struct {
+	TargetClusterID string
+	State           []string
+}
+
+func (q *Queries) CountActiveOperationsToCluster(ctx context.Context, arg CountActiveOperationsToClusterParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countActiveOperationsToCluster,
+		arg.TargetClusterID,
+		arg.State,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countTenantsByCluster = `-- name: CountTenantsByCluster :many
+select cluster_id, count(*) from tenants
+group by cluster_id
+`
+
+type CountTenantsByClusterRow struct {
+	ClusterID string
+	Count     int64
+}
+
+func (q *Queries) CountTenantsByCluster(ctx context.Context) ([]CountTenantsByClusterRow, error) {
+	rows, err := q.db.Query(ctx, countTenantsByCluster)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountTenantsByClusterRow
+	for rows.Next() {
+		var i CountTenantsByClusterRow
+		if err := rows.Scan(
+			&i.ClusterID,
+			&i.Count,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countTenantsByPlan = `-- name: CountTenantsByPlan :one
+select count(*) from tenants
+where plan_id = $1
+`
+
+func (q *Queries) CountTenantsByPlan(ctx context.Context, planID string) (int64, error) {
+	row := q.db.QueryRow(ctx, countTenantsByPlan, planID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countTenantsInCluster = `-- name: CountTenantsInCluster :one
+select count(*) from tenants
+where cluster_id = $1
+`
+
+func (q *Queries) CountTenantsInCluster(ctx context.Context, clusterID string) (int64, error) {
+	row := q.db.QueryRow(ctx, countTenantsInCluster, clusterID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createCluster = `-- name: CreateCluster :one
+insert into clusters (id, name, server, region, labels, capacity, kubeconfig_secret)
+values ($1, $2, $3, $4, $5, $6, $7)
+returning id, name, server, region, labels, capacity, kubeconfig_secret
+`
+
+type CreateClusterParams struct {
+	ID               string
+	Name             string
+	Server           string
+	Region           string
+	Labels           []byte
+	Capacity         int32
+	KubeconfigSecret string
+}
+
+func (q *Queries) CreateCluster(ctx context.Context, arg CreateClusterParams) (Cluster, error) {
+	row := q.db.QueryRow(ctx, createCluster,
+		arg.ID,
+		arg.Name,
+		arg.Server,
+		arg.Region,
+		arg.Labels,
+		arg.Capacity,
+		arg.KubeconfigSecret,
+	)
+	var i Cluster
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Server,
+		&i.Region,
+		&i.Labels,
+		&i.Capacity,
+		&i.KubeconfigSecret,
+	)
+	return i, err
+}
+
+const createOperation = `-- name: CreateOperation :one
+insert into operations (id, tenant_id, type, state, source_cluster_id, target_cluster_id, deadline)
+values ($1, $2, $3, $4, $5, $6, $7)
+returning id, tenant_id, type, state, source_cluster_id, target_cluster_id, message, created_at, updated_at, deadline
+`
+
+type CreateOperationParams struct {
+	ID              string
+	TenantID        string
+	Type            string
+	State           string
+	SourceClusterID string
+	TargetClusterID string
+	Deadline        pgtype.Timestamptz
+}
+
+func (q *Queries) CreateOperation(ctx context.Context, arg CreateOperationParams) (Operation, error) {
+	row := q.db.QueryRow(ctx, createOperation,
+		arg.ID,
+		arg.TenantID,
+		arg.Type,
+		arg.State,
+		arg.SourceClusterID,
+		arg.TargetClusterID,
+		arg.Deadline,
+	)
+	var i Operation
+	err := row.Scan(
+		&i.ID,
+		&i.TenantID,
+		&i.Type,
+		&i.State,
+		&i.SourceClusterID,
+		&i.TargetClusterID,
+		&i.Message,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Deadline,
+	)
+	return i, err
+}
+
+const createPlan = `-- name: CreatePlan :one
+insert into plans (id, name, values_schema, sync_policy)
+values ($1, $2, $3, $4)
+returning id, name, values_schema, sync_policy
+`
+
+type CreatePlanParams struct {
+	ID           string
+	Name         string
+	ValuesSchema []byte
+	SyncPolicy   []byte
+}
+
+func (q *Queries) CreatePlan(ctx context.Context, arg CreatePlanParams) (Plan, error) {
+	row := q.db.QueryRow(ctx, createPlan,
+		arg.ID,
+		arg.Name,
+		arg.ValuesSchema,
+		arg.SyncPolicy,
+	)
+	var i Plan
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ValuesSchema,
+		&i.SyncPolicy,
+	)
+	return i, err
+}
+
 const createTenant = `-- name: CreateTenant :one
-insert into tenants (id, repo_url, path, target_revision, values)
-values ($1, $2, $3, $4, $5)
-returning id, repo_url, path, values, target_revision
+insert into tenants (id, repo_url, path, target_revision, values, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version,
+                     value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values,
+                     plan_id, sync_policy)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+returning id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions
 `
 
 type CreateTenantParams struct {
-	ID             string
-	RepoUrl        string
-	Path           string
-	TargetRevision string
-	Values         []byte
+	ID              string
+	RepoUrl         string
+	Path            string
+	TargetRevision  string
+	Values          []byte
+	ClusterID       string
+	ClusterSelector []byte
+	ChartRepoUrl    string
+	ChartName       string
+	ChartVersion    string
+	ValueFiles      []byte
+	Parameters      []byte
+	FileParameters  []byte
+	Ref             string
+	Sources         []byte
+	SourceType      string
+	Kustomize       []byte
+	Directory       []byte
+	SecretValues    []byte
+	PlanID          string
+	SyncPolicy      []byte
 }
 
 func (q *Queries) CreateTenant(ctx context.Context, arg CreateTenantParams) (Tenant, error) {
@@ -30,6 +238,22 @@ func (q *Queries) CreateTenant(ctx context.Context, arg CreateTenantParams) (Ten
 		arg.Path,
 		arg.TargetRevision,
 		arg.Values,
+		arg.ClusterID,
+		arg.ClusterSelector,
+		arg.ChartRepoUrl,
+		arg.ChartName,
+		arg.ChartVersion,
+		arg.ValueFiles,
+		arg.Parameters,
+		arg.FileParameters,
+		arg.Ref,
+		arg.Sources,
+		arg.SourceType,
+		arg.Kustomize,
+		arg.Directory,
+		arg.SecretValues,
+		arg.PlanID,
+		arg.SyncPolicy,
 	)
 	var i Tenant
 	err := row.Scan(
@@ -38,6 +262,113 @@ func (q *Queries) CreateTenant(ctx context.Context, arg CreateTenantParams) (Ten
 		&i.Path,
 		&i.Values,
 		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
+	)
+	return i, err
+}
+
+const createTenantEvent = `-- name: CreateTenantEvent :one
+insert into tenant_events (id, tenant_id, reason, message, api_version, kind, namespace, name, fields)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+returning id, tenant_id, reason, message, api_version, kind, namespace, name, fields, created_at
+`
+
+type CreateTenantEventParams struct {
+	ID         string
+	TenantID   string
+	Reason     string
+	Message    string
+	ApiVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Fields     []byte
+}
+
+func (q *Queries) CreateTenantEvent(ctx context.Context, arg CreateTenantEventParams) (TenantEvent, error) {
+	row := q.db.QueryRow(ctx, createTenantEvent,
+		arg.ID,
+		arg.TenantID,
+		arg.Reason,
+		arg.Message,
+		arg.ApiVersion,
+		arg.Kind,
+		arg.Namespace,
+		arg.Name,
+		arg.Fields,
+	)
+	var i TenantEvent
+	err := row.Scan(
+		&i.ID,
+		&i.TenantID,
+		&i.Reason,
+		&i.Message,
+		&i.ApiVersion,
+		&i.Kind,
+		&i.Namespace,
+		&i.Name,
+		&i.Fields,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteCluster = `-- name: DeleteCluster :one
+delete from clusters
+where id = $1
+returning id, name, server, region, labels, capacity, kubeconfig_secret
+`
+
+func (q *Queries) DeleteCluster(ctx context.Context, id string) (Cluster, error) {
+	row := q.db.QueryRow(ctx, deleteCluster, id)
+	var i Cluster
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Server,
+		&i.Region,
+		&i.Labels,
+		&i.Capacity,
+		&i.KubeconfigSecret,
+	)
+	return i, err
+}
+
+const deletePlan = `-- name: DeletePlan :one
+delete from plans
+where id = $1
+returning id, name, values_schema, sync_policy
+`
+
+func (q *Queries) DeletePlan(ctx context.Context, id string) (Plan, error) {
+	row := q.db.QueryRow(ctx, deletePlan, id)
+	var i Plan
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ValuesSchema,
+		&i.SyncPolicy,
 	)
 	return i, err
 }
@@ -45,7 +376,7 @@ func (q *Queries) CreateTenant(ctx context.Context, arg CreateTenantParams) (Ten
 const deleteTenant = `-- name: DeleteTenant :one
 delete from tenants
 where id = $1
-returning id, repo_url, path, values, target_revision
+returning id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions
 `
 
 func (q *Queries) DeleteTenant(ctx context.Context, id string) (Tenant, error) {
@@ -57,12 +388,147 @@ func (q *Queries) DeleteTenant(ctx context.Context, id string) (Tenant, error) {
 		&i.Path,
 		&i.Values,
 		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
+	)
+	return i, err
+}
+
+const getActiveOperationByTenant = `-- name: GetActiveOperationByTenant :one
+select id, tenant_id, type, state, source_cluster_id, target_cluster_id, message, created_at, updated_at, deadline from operations
+where tenant_id = $1 and state = any($2::text[])
+limit 1
+`
+
+type GetActiveOperationByTenantParams struct {
+	TenantID string
+	State    []string
+}
+
+func (q *Queries) GetActiveOperationByTenant(ctx context.Context, arg GetActiveOperationByTenantParams) (Operation, error) {
+	row := q.db.QueryRow(ctx, getActiveOperationByTenant,
+		arg.TenantID,
+		arg.State,
+	)
+	var i Operation
+	err := row.Scan(
+		&i.ID,
+		&i.TenantID,
+		&i.Type,
+		&i.State,
+		&i.SourceClusterID,
+		&i.TargetClusterID,
+		&i.Message,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Deadline,
+	)
+	return i, err
+}
+
+const getClusterByID = `-- name: GetClusterByID :one
+select id, name, server, region, labels, capacity, kubeconfig_secret from clusters
+where id = $1
+`
+
+func (q *Queries) GetClusterByID(ctx context.Context, id string) (Cluster, error) {
+	row := q.db.QueryRow(ctx, getClusterByID, id)
+	var i Cluster
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Server,
+		&i.Region,
+		&i.Labels,
+		&i.Capacity,
+		&i.KubeconfigSecret,
+	)
+	return i, err
+}
+
+const getClusterByIDForUpdate = `-- name: GetClusterByIDForUpdate :one
+select id, name, server, region, labels, capacity, kubeconfig_secret from clusters
+where id = $1
+for update
+`
+
+func (q *Queries) GetClusterByIDForUpdate(ctx context.Context, id string) (Cluster, error) {
+	row := q.db.QueryRow(ctx, getClusterByIDForUpdate, id)
+	var i Cluster
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Server,
+		&i.Region,
+		&i.Labels,
+		&i.Capacity,
+		&i.KubeconfigSecret,
+	)
+	return i, err
+}
+
+const getOperationByID = `-- name: GetOperationByID :one
+select id, tenant_id, type, state, source_cluster_id, target_cluster_id, message, created_at, updated_at, deadline from operations
+where id = $1
+`
+
+func (q *Queries) GetOperationByID(ctx context.Context, id string) (Operation, error) {
+	row := q.db.QueryRow(ctx, getOperationByID, id)
+	var i Operation
+	err := row.Scan(
+		&i.ID,
+		&i.TenantID,
+		&i.Type,
+		&i.State,
+		&i.SourceClusterID,
+		&i.TargetClusterID,
+		&i.Message,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Deadline,
+	)
+	return i, err
+}
+
+const getPlanByID = `-- name: GetPlanByID :one
+select id, name, values_schema, sync_policy from plans
+where id = $1
+`
+
+func (q *Queries) GetPlanByID(ctx context.Context, id string) (Plan, error) {
+	row := q.db.QueryRow(ctx, getPlanByID, id)
+	var i Plan
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ValuesSchema,
+		&i.SyncPolicy,
 	)
 	return i, err
 }
 
 const getTenantByID = `-- name: GetTenantByID :one
-select id, repo_url, path, values, target_revision from tenants
+select id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions from tenants
 where id = $1
 `
 
@@ -75,12 +541,244 @@ func (q *Queries) GetTenantByID(ctx context.Context, id string) (Tenant, error)
 		&i.Path,
 		&i.Values,
 		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
 	)
 	return i, err
 }
 
+const listClusters = `-- name: ListClusters :many
+select id, name, server, region, labels, capacity, kubeconfig_secret from clusters
+order by id
+`
+
+func (q *Queries) ListClusters(ctx context.Context) ([]Cluster, error) {
+	rows, err := q.db.Query(ctx, listClusters)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Cluster
+	for rows.Next() {
+		var i Cluster
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Server,
+			&i.Region,
+			&i.Labels,
+			&i.Capacity,
+			&i.KubeconfigSecret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOperations = `-- name: ListOperations :many
+select id, tenant_id, type, state, source_cluster_id, target_cluster_id, message, created_at, updated_at, deadline from operations
+order by created_at desc
+`
+
+func (q *Queries) ListOperations(ctx context.Context) ([]Operation, error) {
+	rows, err := q.db.Query(ctx, listOperations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Operation
+	for rows.Next() {
+		var i Operation
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.Type,
+			&i.State,
+			&i.SourceClusterID,
+			&i.TargetClusterID,
+			&i.Message,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Deadline,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOperationsByState = `-- name: ListOperationsByState :many
+select id, tenant_id, type, state, source_cluster_id, target_cluster_id, message, created_at, updated_at, deadline from operations
+where state = any($1::text[])
+order by created_at
+`
+
+func (q *Queries) ListOperationsByState(ctx context.Context, state []string) ([]Operation, error) {
+	rows, err := q.db.Query(ctx, listOperationsByState, state)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Operation
+	for rows.Next() {
+		var i Operation
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.Type,
+			&i.State,
+			&i.SourceClusterID,
+			&i.TargetClusterID,
+			&i.Message,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Deadline,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOperationsByTenant = `-- name: ListOperationsByTenant :many
+select id, tenant_id, type, state, source_cluster_id, target_cluster_id, message, created_at, updated_at, deadline from operations
+where tenant_id = $1
+order by created_at desc
+`
+
+func (q *Queries) ListOperationsByTenant(ctx context.Context, tenantID string) ([]Operation, error) {
+	rows, err := q.db.Query(ctx, listOperationsByTenant, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Operation
+	for rows.Next() {
+		var i Operation
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.Type,
+			&i.State,
+			&i.SourceClusterID,
+			&i.TargetClusterID,
+			&i.Message,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Deadline,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPlans = `-- name: ListPlans :many
+select id, name, values_schema, sync_policy from plans
+order by id
+`
+
+func (q *Queries) ListPlans(ctx context.Context) ([]Plan, error) {
+	rows, err := q.db.Query(ctx, listPlans)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Plan
+	for rows.Next() {
+		var i Plan
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.ValuesSchema,
+			&i.SyncPolicy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTenantEvents = `-- name: ListTenantEvents :many
+select id, tenant_id, reason, message, api_version, kind, namespace, name, fields, created_at from tenant_events
+where tenant_id = $1
+order by created_at desc
+`
+
+func (q *Queries) ListTenantEvents(ctx context.Context, tenantID string) ([]TenantEvent, error) {
+	rows, err := q.db.Query(ctx, listTenantEvents, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TenantEvent
+	for rows.Next() {
+		var i TenantEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.Reason,
+			&i.Message,
+			&i.ApiVersion,
+			&i.Kind,
+			&i.Namespace,
+			&i.Name,
+			&i.Fields,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listTenants = `-- name: ListTenants :many
-select id, repo_url, path, values, target_revision from tenants
+select id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions from tenants
 order by id
 `
 
@@ -99,6 +797,28 @@ func (q *Queries) ListTenants(ctx context.Context) ([]Tenant, error) {
 			&i.Path,
 			&i.Values,
 			&i.TargetRevision,
+			&i.ClusterID,
+			&i.ClusterSelector,
+			&i.ChartRepoUrl,
+			&i.ChartName,
+			&i.ChartVersion,
+			&i.ValueFiles,
+			&i.Parameters,
+			&i.FileParameters,
+			&i.Ref,
+			&i.Sources,
+			&i.SourceType,
+			&i.Kustomize,
+			&i.Directory,
+			&i.SecretValues,
+			&i.PlanID,
+			&i.Suspended,
+			&i.ScaleDown,
+			&i.SuspendedReplicas,
+			&i.SyncPolicy,
+			&i.DriftCount,
+			&i.LastDrift,
+			&i.Conditions,
 		); err != nil {
 			return nil, err
 		}
@@ -110,11 +830,347 @@ func (q *Queries) ListTenants(ctx context.Context) ([]Tenant, error) {
 	return items, nil
 }
 
+const pruneTenantEvents = `-- name: PruneTenantEvents :execrows
+delete from tenant_events
+where created_at < $1
+   or tenant_id not in (select id from tenants)
+   or id in (select ranked.id
+             from (select id, row_number() over (partition by tenant_id order by created_at desc) as position
+                   from tenant_events) ranked
+             where ranked.position > $2::bigint)
+`
+
+type PruneTenantEventsParams struct {
+	CreatedAt pgtype.Timestamptz
+	Position  int64
+}
+
+func (q *Queries) PruneTenantEvents(ctx context.Context, arg PruneTenantEventsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, pruneTenantEvents,
+		arg.CreatedAt,
+		arg.Position,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recordTenantDrift = `-- name: RecordTenantDrift :one
+update tenants
+set drift_count = drift_count + 1, last_drift = $2
+where id = $1
+returning id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions
+`
+
+type RecordTenantDriftParams struct {
+	ID        string
+	LastDrift []byte
+}
+
+func (q *Queries) RecordTenantDrift(ctx context.Context, arg RecordTenantDriftParams) (Tenant, error) {
+	row := q.db.QueryRow(ctx, recordTenantDrift,
+		arg.ID,
+		arg.LastDrift,
+	)
+	var i Tenant
+	err := row.Scan(
+		&i.ID,
+		&i.RepoUrl,
+		&i.Path,
+		&i.Values,
+		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
+	)
+	return i, err
+}
+
+const setTenantConditions = `-- name: SetTenantConditions :one
+update tenants
+set conditions = $2
+where id = $1
+returning id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions
+`
+
+type SetTenantConditionsParams struct {
+	ID         string
+	Conditions []byte
+}
+
+func (q *Queries) SetTenantConditions(ctx context.Context, arg SetTenantConditionsParams) (Tenant, error) {
+	row := q.db.QueryRow(ctx, setTenantConditions,
+		arg.ID,
+		arg.Conditions,
+	)
+	var i Tenant
+	err := row.Scan(
+		&i.ID,
+		&i.RepoUrl,
+		&i.Path,
+		&i.Values,
+		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
+	)
+	return i, err
+}
+
+const setTenantSuspended = `-- name: SetTenantSuspended :one
+update tenants
+set suspended = $2, scale_down = $3
+where id = $1
+returning id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions
+`
+
+type SetTenantSuspendedParams struct {
+	ID        string
+	Suspended bool
+	ScaleDown bool
+}
+
+func (q *Queries) SetTenantSuspended(ctx context.Context, arg SetTenantSuspendedParams) (Tenant, error) {
+	row := q.db.QueryRow(ctx, setTenantSuspended,
+		arg.ID,
+		arg.Suspended,
+		arg.ScaleDown,
+	)
+	var i Tenant
+	err := row.Scan(
+		&i.ID,
+		&i.RepoUrl,
+		&i.Path,
+		&i.Values,
+		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
+	)
+	return i, err
+}
+
+const setTenantSuspendedReplicas = `-- name: SetTenantSuspendedReplicas :one
+update tenants
+set suspended_replicas = $2
+where id = $1
+returning id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions
+`
+
+type SetTenantSuspendedReplicasParams struct {
+	ID                string
+	SuspendedReplicas []byte
+}
+
+func (q *Queries) SetTenantSuspendedReplicas(ctx context.Context, arg SetTenantSuspendedReplicasParams) (Tenant, error) {
+	row := q.db.QueryRow(ctx, setTenantSuspendedReplicas,
+		arg.ID,
+		arg.SuspendedReplicas,
+	)
+	var i Tenant
+	err := row.Scan(
+		&i.ID,
+		&i.RepoUrl,
+		&i.Path,
+		&i.Values,
+		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
+	)
+	return i, err
+}
+
+const updateCluster = `-- name: UpdateCluster :one
+update clusters
+set name = $2, server = $3, region = $4, labels = $5, capacity = $6, kubeconfig_secret = $7
+where id = $1
+returning id, name, server, region, labels, capacity, kubeconfig_secret
+`
+
+type UpdateClusterParams struct {
+	ID               string
+	Name             string
+	Server           string
+	Region           string
+	Labels           []byte
+	Capacity         int32
+	KubeconfigSecret string
+}
+
+func (q *Queries) UpdateCluster(ctx context.Context, arg UpdateClusterParams) (Cluster, error) {
+	row := q.db.QueryRow(ctx, updateCluster,
+		arg.ID,
+		arg.Name,
+		arg.Server,
+		arg.Region,
+		arg.Labels,
+		arg.Capacity,
+		arg.KubeconfigSecret,
+	)
+	var i Cluster
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Server,
+		&i.Region,
+		&i.Labels,
+		&i.Capacity,
+		&i.KubeconfigSecret,
+	)
+	return i, err
+}
+
+const updateOperationState = `-- name: UpdateOperationState :one
+update operations
+set state = $2, message = $3, updated_at = now()
+where id = $1
+returning id, tenant_id, type, state, source_cluster_id, target_cluster_id, message, created_at, updated_at, deadline
+`
+
+type UpdateOperationStateParams struct {
+	ID      string
+	State   string
+	Message string
+}
+
+func (q *Queries) UpdateOperationState(ctx context.Context, arg UpdateOperationStateParams) (Operation, error) {
+	row := q.db.QueryRow(ctx, updateOperationState,
+		arg.ID,
+		arg.State,
+		arg.Message,
+	)
+	var i Operation
+	err := row.Scan(
+		&i.ID,
+		&i.TenantID,
+		&i.Type,
+		&i.State,
+		&i.SourceClusterID,
+		&i.TargetClusterID,
+		&i.Message,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Deadline,
+	)
+	return i, err
+}
+
+const updatePlan = `-- name: UpdatePlan :one
+update plans
+set name = $2, values_schema = $3, sync_policy = $4
+where id = $1
+returning id, name, values_schema, sync_policy
+`
+
+type UpdatePlanParams struct {
+	ID           string
+	Name         string
+	ValuesSchema []byte
+	SyncPolicy   []byte
+}
+
+func (q *Queries) UpdatePlan(ctx context.Context, arg UpdatePlanParams) (Plan, error) {
+	row := q.db.QueryRow(ctx, updatePlan,
+		arg.ID,
+		arg.Name,
+		arg.ValuesSchema,
+		arg.SyncPolicy,
+	)
+	var i Plan
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ValuesSchema,
+		&i.SyncPolicy,
+	)
+	return i, err
+}
+
 const updateTenant = `-- name: UpdateTenant :one
 update tenants
-set repo_url = $2, path = $3, target_revision = $4, values = $5
+set repo_url = $2, path = $3, target_revision = $4, values = $5, chart_repo_url = $6, chart_name = $7, chart_version = $8,
+    value_files = $9, parameters = $10, file_parameters = $11, ref = $12, sources = $13,
+    source_type = $14, kustomize = $15, directory = $16, secret_values = $17, sync_policy = $18
 where id = $1
-returning id, repo_url, path, values, target_revision
+returning id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions
 `
 
 type UpdateTenantParams struct {
@@ -123,6 +1179,19 @@ type UpdateTenantParams struct {
 	Path           string
 	TargetRevision string
 	Values         []byte
+	ChartRepoUrl   string
+	ChartName      string
+	ChartVersion   string
+	ValueFiles     []byte
+	Parameters     []byte
+	FileParameters []byte
+	Ref            string
+	Sources        []byte
+	SourceType     string
+	Kustomize      []byte
+	Directory      []byte
+	SecretValues   []byte
+	SyncPolicy     []byte
 }
 
 func (q *Queries) UpdateTenant(ctx context.Context, arg UpdateTenantParams) (Tenant, error) {
@@ -132,6 +1201,69 @@ func (q *Queries) UpdateTenant(ctx context.Context, arg UpdateTenantParams) (Ten
 		arg.Path,
 		arg.TargetRevision,
 		arg.Values,
+		arg.ChartRepoUrl,
+		arg.ChartName,
+		arg.ChartVersion,
+		arg.ValueFiles,
+		arg.Parameters,
+		arg.FileParameters,
+		arg.Ref,
+		arg.Sources,
+		arg.SourceType,
+		arg.Kustomize,
+		arg.Directory,
+		arg.SecretValues,
+		arg.SyncPolicy,
+	)
+	var i Tenant
+	err := row.Scan(
+		&i.ID,
+		&i.RepoUrl,
+		&i.Path,
+		&i.Values,
+		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
+	)
+	return i, err
+}
+
+const updateTenantCluster = `-- name: UpdateTenantCluster :one
+update tenants
+set cluster_id = $2
+where id = $1
+returning id, repo_url, path, values, target_revision, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version, value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values, plan_id, suspended, scale_down, suspended_replicas, sync_policy, drift_count, last_drift, conditions
+`
+
+type UpdateTenantClusterParams struct {
+	ID        string
+	ClusterID string
+}
+
+func (q *Queries) UpdateTenantCluster(ctx context.Context, arg UpdateTenantClusterParams) (Tenant, error) {
+	row := q.db.QueryRow(ctx, updateTenantCluster,
+		arg.ID,
+		arg.ClusterID,
 	)
 	var i Tenant
 	err := row.Scan(
@@ -140,6 +1272,28 @@ func (q *Queries) UpdateTenant(ctx context.Context, arg UpdateTenantParams) (Ten
 		&i.Path,
 		&i.Values,
 		&i.TargetRevision,
+		&i.ClusterID,
+		&i.ClusterSelector,
+		&i.ChartRepoUrl,
+		&i.ChartName,
+		&i.ChartVersion,
+		&i.ValueFiles,
+		&i.Parameters,
+		&i.FileParameters,
+		&i.Ref,
+		&i.Sources,
+		&i.SourceType,
+		&i.Kustomize,
+		&i.Directory,
+		&i.SecretValues,
+		&i.PlanID,
+		&i.Suspended,
+		&i.ScaleDown,
+		&i.SuspendedReplicas,
+		&i.SyncPolicy,
+		&i.DriftCount,
+		&i.LastDrift,
+		&i.Conditions,
 	)
 	return i, err
 }
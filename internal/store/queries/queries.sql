@@ -7,17 +7,173 @@ select * from tenants
 order by id;
 
 -- name: CreateTenant :one
-insert into tenants (id, repo_url, path, target_revision, values)
-values ($1, $2, $3, $4, $5)
+insert into tenants (id, repo_url, path, target_revision, values, cluster_id, cluster_selector, chart_repo_url, chart_name, chart_version,
+                     value_files, parameters, file_parameters, ref, sources, source_type, kustomize, directory, secret_values,
+                     plan_id, sync_policy)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 returning *;
 
 -- name: UpdateTenant :one
 update tenants
-set repo_url = $2, path = $3, target_revision = $4, values = $5
+set repo_url = $2, path = $3, target_revision = $4, values = $5, chart_repo_url = $6, chart_name = $7, chart_version = $8,
+    value_files = $9, parameters = $10, file_parameters = $11, ref = $12, sources = $13,
+    source_type = $14, kustomize = $15, directory = $16, secret_values = $17, sync_policy = $18
 where id = $1
 returning *;
 
 -- name: DeleteTenant :one
 delete from tenants
 where id = $1
-returning *;
\ No newline at end of file
+returning *;
+
+-- name: CountTenantsByCluster :many
+select cluster_id, count(*) from tenants
+group by cluster_id;
+
+-- name: GetClusterByID :one
+select * from clusters
+where id = $1;
+
+-- name: GetClusterByIDForUpdate :one
+select * from clusters
+where id = $1
+for update;
+
+-- name: CountTenantsInCluster :one
+select count(*) from tenants
+where cluster_id = $1;
+
+-- name: ListClusters :many
+select * from clusters
+order by id;
+
+-- name: CreateCluster :one
+insert into clusters (id, name, server, region, labels, capacity, kubeconfig_secret)
+values ($1, $2, $3, $4, $5, $6, $7)
+returning *;
+
+-- name: UpdateCluster :one
+update clusters
+set name = $2, server = $3, region = $4, labels = $5, capacity = $6, kubeconfig_secret = $7
+where id = $1
+returning *;
+
+-- name: DeleteCluster :one
+delete from clusters
+where id = $1
+returning *;
+
+-- name: UpdateTenantCluster :one
+update tenants
+set cluster_id = $2
+where id = $1
+returning *;
+
+-- name: GetOperationByID :one
+select * from operations
+where id = $1;
+
+-- name: ListOperations :many
+select * from operations
+order by created_at desc;
+
+-- name: ListOperationsByTenant :many
+select * from operations
+where tenant_id = $1
+order by created_at desc;
+
+-- name: ListOperationsByState :many
+select * from operations
+where state = any($1::text[])
+order by created_at;
+
+-- name: GetActiveOperationByTenant :one
+select * from operations
+where tenant_id = $1 and state = any($2::text[])
+limit 1;
+
+-- name: CountActiveOperationsToCluster :one
+select count(*) from operations
+where target_cluster_id = $1 and state = any($2::text[]);
+
+-- name: CreateOperation :one
+insert into operations (id, tenant_id, type, state, source_cluster_id, target_cluster_id, deadline)
+values ($1, $2, $3, $4, $5, $6, $7)
+returning *;
+
+-- name: UpdateOperationState :one
+update operations
+set state = $2, message = $3, updated_at = now()
+where id = $1
+returning *;
+
+-- name: SetTenantSuspended :one
+update tenants
+set suspended = $2, scale_down = $3
+where id = $1
+returning *;
+
+-- name: SetTenantSuspendedReplicas :one
+update tenants
+set suspended_replicas = $2
+where id = $1
+returning *;
+
+-- name: GetPlanByID :one
+select * from plans
+where id = $1;
+
+-- name: ListPlans :many
+select * from plans
+order by id;
+
+-- name: CreatePlan :one
+insert into plans (id, name, values_schema, sync_policy)
+values ($1, $2, $3, $4)
+returning *;
+
+-- name: UpdatePlan :one
+update plans
+set name = $2, values_schema = $3, sync_policy = $4
+where id = $1
+returning *;
+
+-- name: DeletePlan :one
+delete from plans
+where id = $1
+returning *;
+
+-- name: CountTenantsByPlan :one
+select count(*) from tenants
+where plan_id = $1;
+
+-- name: CreateTenantEvent :one
+insert into tenant_events (id, tenant_id, reason, message, api_version, kind, namespace, name, fields)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+returning *;
+
+-- name: ListTenantEvents :many
+select * from tenant_events
+where tenant_id = $1
+order by created_at desc;
+
+-- name: RecordTenantDrift :one
+update tenants
+set drift_count = drift_count + 1, last_drift = $2
+where id = $1
+returning *;
+
+-- name: SetTenantConditions :one
+update tenants
+set conditions = $2
+where id = $1
+returning *;
+
+-- name: PruneTenantEvents :execrows
+delete from tenant_events
+where created_at < $1
+   or tenant_id not in (select id from tenants)
+   or id in (select ranked.id
+             from (select id, row_number() over (partition by tenant_id order by created_at desc) as position
+                   from tenant_events) ranked
+             where ranked.position > $2::bigint);
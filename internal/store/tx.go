@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+)
+
+// Beginner starts transactions, a pgxpool.Pool for instance
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Transactor runs queries within transactions, instrument wraps each transaction like the DBTX of the queries run outside of them
+type Transactor struct {
+	db         Beginner
+	instrument func(DBTX) DBTX
+}
+
+func NewTransactor(db Beginner, instrument func(DBTX) DBTX) *Transactor {
+	return &Transactor{db: db, instrument: instrument}
+}
+
+// InTx runs fn with queries bound to a transaction, which is committed when fn succeeds and rolled back otherwise
+func (t *Transactor) InTx(ctx context.Context, fn func(q *Queries) error) error {
+	tx, err := t.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction does nothing, a canceled ctx must not prevent the rollback
+	defer tx.Rollback(context.WithoutCancel(ctx))
+	if err := fn(New(t.instrument(tx))); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
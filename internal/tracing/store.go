@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"poc-cloud-service/internal/store"
+)
+
+// DB starts a span for each query run on a store.DBTX, named after the store.Queries method running it
+type DB struct {
+	db store.DBTX
+}
+
+var _ store.DBTX = (*DB)(nil)
+
+// InstrumentDB returns db tracing its queries
+func InstrumentDB(db store.DBTX) *DB {
+	return &DB{db: db}
+}
+
+func (d *DB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span := startQuery(ctx, sql)
+	tag, err := d.db.Exec(ctx, sql, args...)
+	End(span, err)
+	return tag, err
+}
+
+func (d *DB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span := startQuery(ctx, sql)
+	rows, err := d.db.Query(ctx, sql, args...)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	return &spanRows{Rows: rows, span: span}, nil
+}
+
+func (d *DB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, span := startQuery(ctx, sql)
+	return &spanRow{Row: d.db.QueryRow(ctx, sql, args...), span: span}
+}
+
+func startQuery(ctx context.Context, sql string) (context.Context, trace.Span) {
+	return Tracer.Start(ctx, "store."+store.QueryName(sql), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", sql),
+	))
+}
+
+// spanRows ends the span of a query once its rows are closed
+type spanRows struct {
+	pgx.Rows
+	span trace.Span
+}
+
+func (r *spanRows) Close() {
+	r.Rows.Close()
+	if r.span.IsRecording() {
+		End(r.span, r.Rows.Err())
+	}
+}
+
+// spanRow ends the span of a query once its row is scanned
+type spanRow struct {
+	pgx.Row
+	span trace.Span
+}
+
+func (r *spanRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if err == pgx.ErrNoRows {
+		End(r.span, nil)
+	} else {
+		End(r.span, err)
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// Headers identifying requests, the gateway forwards them to the gRPC server as metadata
+const (
+	RequestIDHeader = "X-Request-Id"
+	// UserHeader and EmailHeader are set by the authenticating proxy in front of the service, see TrustedProxies
+	UserHeader  = "X-Forwarded-User"
+	EmailHeader = "X-Forwarded-Email"
+)
+
+// TrustedProxies are the addresses allowed to tell who makes a request with UserHeader and EmailHeader
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses proxy addresses, each a CIDR or a single IP
+func ParseTrustedProxies(addresses []string) (TrustedProxies, error) {
+	proxies := TrustedProxies{}
+	for _, address := range addresses {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(address)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q, expected a CIDR or an IP", address)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// Trusts tells whether a remote address, an IP and a port, is one of the proxies
+func (t TrustedProxies) Trusts(remoteAddr string) bool {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor attaches the request to the context logger and logs each request once it is served.
+// The principal is only read from callers on the loopback, the gateway, or from the trusted proxies.
+func UnaryServerInterceptor(proxies TrustedProxies) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		md, _ := metadata.FromIncomingContext(ctx)
+		request := Request{
+			ID:     firstValue(md, RequestIDHeader),
+			Method: info.FullMethod,
+		}
+		if request.ID == "" {
+			request.ID = xid.New().String()
+		}
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil && trustsPeer(proxies, p.Addr.String()) {
+			request.Principal = firstValue(md, UserHeader)
+			if request.Principal == "" {
+				request.Principal = firstValue(md, EmailHeader)
+			}
+		}
+		ctx = WithRequest(ctx, request)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, request.ID))
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		fields := []zap.Field{zap.String("code", code.String()), zap.Duration("duration", time.Since(start))}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		}
+		FromContext(ctx).Check(grpcLevel(code), "gRPC request").Write(fields...)
+		return resp, err
+	}
+}
+
+// trustsPeer tells whether a gRPC caller may set the principal. The gateway calls from the loopback, after
+// HTTPHandler dropped the headers of untrusted callers.
+func trustsPeer(proxies TrustedProxies, remoteAddr string) bool {
+	if addrPort, err := netip.ParseAddrPort(remoteAddr); err == nil && addrPort.Addr().IsLoopback() {
+		return true
+	}
+	return proxies.Trusts(remoteAddr)
+}
+
+// firstValue returns the first value of a metadata key, empty if it is not set
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcLevel logs server failures as errors and caller mistakes as warnings
+func grpcLevel(code codes.Code) zapcore.Level {
+	switch code {
+	case codes.OK:
+		return zap.InfoLevel
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.FailedPrecondition, codes.OutOfRange, codes.Unauthenticated, codes.ResourceExhausted, codes.Aborted:
+		return zap.WarnLevel
+	}
+	return zap.ErrorLevel
+}
+
+// HTTPHandler attaches the request to the context logger and logs each request once it is served.
+// The request id is generated when the caller did not send one, and forwarded to the gRPC server.
+// The principal headers are dropped unless the caller is one of the trusted proxies.
+// Requests to quiet paths, like health checks, are only logged at debug level.
+func HTTPHandler(handler http.Handler, proxies TrustedProxies, quietPaths ...string) http.Handler {
+	quiet := map[string]bool{}
+	for _, p := range quietPaths {
+		quiet[p] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		if !proxies.Trusts(r.RemoteAddr) {
+			r.Header.Del(UserHeader)
+			r.Header.Del(EmailHeader)
+		}
+		request := Request{
+			ID:        r.Header.Get(RequestIDHeader),
+			Principal: r.Header.Get(UserHeader),
+			Method:    r.Method + " " + r.URL.Path,
+		}
+		if request.ID == "" {
+			request.ID = xid.New().String()
+			r.Header.Set(RequestIDHeader, request.ID)
+		}
+		if request.Principal == "" {
+			request.Principal = r.Header.Get(EmailHeader)
+		}
+		w.Header().Set(RequestIDHeader, request.ID)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, r.WithContext(WithRequest(r.Context(), request)))
+
+		lvl := zap.InfoLevel
+		switch {
+		case quiet[r.URL.Path]:
+			lvl = zap.DebugLevel
+		case recorder.status >= http.StatusInternalServerError:
+			lvl = zap.ErrorLevel
+		case recorder.status >= http.StatusBadRequest:
+			lvl = zap.WarnLevel
+		}
+		FromContext(WithRequest(r.Context(), request)).Check(lvl, "HTTP request").Write(
+			zap.Int("status", recorder.status),
+			zap.Int("bytes", recorder.bytes),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("remote", r.RemoteAddr),
+			zap.String("user_agent", r.UserAgent()),
+		)
+	})
+}
+
+// statusRecorder records the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
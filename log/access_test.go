@@ -0,0 +1,119 @@
+package log
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.10", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+	tests := []struct {
+		remoteAddr string
+		want       bool
+	}{
+		{remoteAddr: "10.1.2.3:1234", want: true},
+		{remoteAddr: "192.168.1.10:1234", want: true},
+		{remoteAddr: "192.168.1.11:1234", want: false},
+		{remoteAddr: "[fd00::1]:1234", want: true},
+		{remoteAddr: "[::ffff:10.1.2.3]:1234", want: true},
+		{remoteAddr: "127.0.0.1:1234", want: false},
+		{remoteAddr: "not an address", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.remoteAddr, func(t *testing.T) {
+			if got := proxies.Trusts(test.remoteAddr); got != test.want {
+				t.Errorf("Trusts(%q) = %t, want %t", test.remoteAddr, got, test.want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"proxy.example.com"}); err == nil {
+		t.Error("ParseTrustedProxies() accepted a host name")
+	}
+}
+
+func TestHTTPHandlerPrincipal(t *testing.T) {
+
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{name: "trusted user", remoteAddr: "10.0.0.1:1234", headers: map[string]string{UserHeader: "alice", EmailHeader: "alice@example.com"}, want: "alice"},
+		{name: "trusted email", remoteAddr: "10.0.0.1:1234", headers: map[string]string{EmailHeader: "alice@example.com"}, want: "alice@example.com"},
+		{name: "untrusted", remoteAddr: "10.0.0.2:1234", headers: map[string]string{UserHeader: "alice", EmailHeader: "alice@example.com"}, want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got string
+			var forwarded http.Header
+			handler := HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				request, _ := GetRequest(r.Context())
+				got = request.Principal
+				forwarded = r.Header
+			}), proxies)
+			r := httptest.NewRequest(http.MethodGet, "/v1/tenants", nil)
+			r.RemoteAddr = test.remoteAddr
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got != test.want {
+				t.Errorf("principal = %q, want %q", got, test.want)
+			}
+			if test.want == "" && (forwarded.Get(UserHeader) != "" || forwarded.Get(EmailHeader) != "") {
+				t.Errorf("untrusted principal headers are forwarded: %v", forwarded)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptorPrincipal(t *testing.T) {
+
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		peer net.Addr
+		want string
+	}{
+		{name: "gateway", peer: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}, want: "alice"},
+		{name: "trusted proxy", peer: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}, want: "alice"},
+		{name: "untrusted", peer: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 1234}, want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(UserHeader, "alice"))
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: test.peer})
+			var got string
+			_, err := UnaryServerInterceptor(proxies)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				request, _ := GetRequest(ctx)
+				got = request.Principal
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("principal = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -2,23 +2,80 @@ package log
 
 import (
 	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Formats selectable with Configure
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
 )
 
 var logger *zap.Logger
 
+// level is shared by every logger, so that it can be changed at runtime
+var level = zap.NewAtomicLevelAt(zap.InfoLevel)
+
 func init() {
-	logger, _ = zap.NewProduction()
+	logger, _ = newLogger(FormatJSON)
+}
+
+// Configure replaces the logger with one logging from level in format
+func Configure(levelName, format string) error {
+	parsed, err := zapcore.ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	l, err := newLogger(format)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(parsed)
+	logger = l
+	return nil
+}
+
+func newLogger(format string) (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	config.Level = level
+	switch format {
+	case FormatJSON:
+	case FormatConsole:
+		config.Encoding = FormatConsole
+		config.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return config.Build()
+}
+
+// Level is the level of the loggers, its ServeHTTP reads it on GET and changes it on PUT with {"level":"debug"}
+func Level() zap.AtomicLevel {
+	return level
 }
 
 func FromContext(ctx context.Context) *zap.Logger {
 	if ctx == nil {
 		return logger
 	}
+	l := logger
+	if request, ok := GetRequest(ctx); ok {
+		fields := []zap.Field{zap.String("request_id", request.ID), zap.String("method", request.Method)}
+		if request.Principal != "" {
+			fields = append(fields, zap.String("principal", request.Principal))
+		}
+		l = l.With(fields...)
+	}
 	if tenant := GetTenant(ctx); tenant != "" {
-		return logger.With(zap.String("tenant", tenant))
+		l = l.With(zap.String("tenant", tenant))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		l = l.With(zap.String("trace_id", spanContext.TraceID().String()), zap.String("span_id", spanContext.SpanID().String()))
 	}
-	return logger
+	return l
 }
 
 type tenantKey struct{}
@@ -36,3 +93,26 @@ func GetTenant(ctx context.Context) string {
 	}
 	return ""
 }
+
+// Request identifies the API request a context serves
+type Request struct {
+	ID string
+	// Principal is who made the request, as forwarded by a trusted proxy in front of the service, empty if unknown
+	Principal string
+	// Method is the full gRPC method, or the HTTP method and path
+	Method string
+}
+
+type requestKey struct{}
+
+func WithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+func GetRequest(ctx context.Context) (Request, bool) {
+	if ctx == nil {
+		return Request{}, false
+	}
+	request, ok := ctx.Value(requestKey{}).(Request)
+	return request, ok
+}